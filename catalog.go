@@ -0,0 +1,89 @@
+package testy
+
+import (
+	"time"
+)
+
+// Catalog describes the registered tests of a Suite, without running them.
+type Catalog struct {
+	// Hooks are the names of the suite's Before/After functions that are registered, such as "BeforeSuite".
+	Hooks []string `json:",omitempty"`
+	// Packages are the packages that have at least one test, in lexicographical order.
+	Packages []CatalogPackage
+}
+
+// CatalogPackage describes the registered tests of a single package.
+type CatalogPackage struct {
+	Name string
+	// Hooks are the package's Before/After functions that are registered.
+	Hooks []Hook `json:",omitempty"`
+	// Tests are the package's tests, in lexicographical order.
+	Tests []CatalogTest
+}
+
+// CatalogTest describes a single registered test.
+type CatalogTest struct {
+	Package string
+	Name    string
+	// Timeout is how long the test may run for when run via Run, or zero if it does not time out.
+	Timeout time.Duration `json:",omitempty"`
+	// Retries is how many more times the test is run if it fails when run via Run.
+	Retries  int       `json:",omitempty"`
+	Metadata *Metadata `json:",omitempty"`
+}
+
+// ListTests returns the catalog of the tests that RunWithOptions would run with opts, without running them.
+// The zero value options list every registered test.
+// Subtests are not listed, as they are only known once their parent test runs.
+//
+// An error is returned if opts is invalid.
+func ListTests(opts RunOptions) (Catalog, error) {
+	return instance.ListTests(opts)
+}
+
+// ListTests is like the package-level ListTests, but lists the tests registered with s.
+func (s *Suite) ListTests(opts RunOptions) (Catalog, error) {
+	cfg, err := opts.parse()
+	if err != nil {
+		return Catalog{}, err
+	}
+
+	var catalog Catalog
+	beforeSuite, afterSuite := s.suiteHooks()
+	if beforeSuite != nil {
+		catalog.Hooks = append(catalog.Hooks, "BeforeSuite")
+	}
+	if afterSuite != nil {
+		catalog.Hooks = append(catalog.Hooks, "AfterSuite")
+	}
+
+	for _, pp := range s.selectTests(cfg) {
+		pkg := CatalogPackage{
+			Name:  pp.pkg.name,
+			Tests: make([]CatalogTest, 0, len(pp.tests)),
+		}
+		for _, hook := range []Hook{
+			HookBeforePackage, HookAfterPackage, HookBeforeTest, HookAfterTest, HookBeforeEach, HookAfterEach,
+		} {
+			if *packageHooks[hook](pp.pkg) != nil {
+				pkg.Hooks = append(pkg.Hooks, hook)
+			}
+		}
+		for _, test := range pp.tests {
+			ct := CatalogTest{
+				Package:  test.Package,
+				Name:     test.Name,
+				Metadata: test.resultMetadata(),
+			}
+			if timeout := cfg.testTimeout(pp.pkg, test); timeout > 0 {
+				ct.Timeout = timeout
+			}
+			if retries := cfg.testRetries(pp.pkg, test); retries > 0 {
+				ct.Retries = retries
+			}
+			pkg.Tests = append(pkg.Tests, ct)
+		}
+		catalog.Packages = append(catalog.Packages, pkg)
+	}
+	return catalog, nil
+}
@@ -0,0 +1,59 @@
+package testy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListTests(t *testing.T) {
+	instance = &Suite{}
+
+	ran := false
+	Test("b", func(t TestingT) { ran = true }, Timeout(time.Second))
+	Test("a", func(t TestingT) { ran = true }, Tags("smoke"), Owner("core"))
+	BeforePackage(func(t TestingT) { ran = true })
+	AfterEach(func(t TestingT) { ran = true })
+	AfterSuite(func(t TestingT) { ran = true })
+	require.NoError(t, RegisterTest("example.com/empty", "c", func(t TestingT) { ran = true }))
+
+	catalog, err := ListTests(RunOptions{Timeout: time.Minute})
+	require.NoError(t, err)
+	assert.False(t, ran, "nothing is run")
+	assert.Equal(t, Catalog{
+		Hooks: []string{"AfterSuite"},
+		Packages: []CatalogPackage{
+			{
+				Name: "example.com/empty",
+				Tests: []CatalogTest{
+					{Package: "example.com/empty", Name: "c", Timeout: time.Minute},
+				},
+			},
+			{
+				Name:  "github.com/gametimesf/testy",
+				Hooks: []Hook{HookBeforePackage, HookAfterEach},
+				Tests: []CatalogTest{
+					{
+						Package:  "github.com/gametimesf/testy",
+						Name:     "a",
+						Timeout:  time.Minute,
+						Metadata: &Metadata{Tags: []string{"smoke"}, Owner: "core"},
+					},
+					{Package: "github.com/gametimesf/testy", Name: "b", Timeout: time.Second},
+				},
+			},
+		},
+	}, catalog)
+
+	catalog, err = ListTests(RunOptions{Tags: []string{"smoke"}})
+	require.NoError(t, err)
+	require.Len(t, catalog.Packages, 1)
+	require.Len(t, catalog.Packages[0].Tests, 1)
+	assert.Equal(t, "a", catalog.Packages[0].Tests[0].Name)
+	assert.Zero(t, catalog.Packages[0].Tests[0].Timeout)
+
+	_, err = ListTests(RunOptions{Run: "("})
+	assert.Error(t, err)
+}
@@ -27,6 +27,12 @@ type DB interface {
 	Save(context.Context, TestResult) (string, error)
 }
 
+// ProfileEnumerator may be implemented by a DB to support listing only the test results of a single profile.
+type ProfileEnumerator interface {
+	// EnumerateProfile is like DB.Enumerate, but only lists the test results whose Profile is profile.
+	EnumerateProfile(ctx context.Context, profile string, page int) (results []Summary, more bool, err error)
+}
+
 // Summary is an overview of a TestResult, used to populate the list of past results.
 type Summary struct {
 	// ID is an opaque unique identifier for a test result. The specific format is defined by the datastore.
@@ -41,6 +47,14 @@ type Summary struct {
 	Passed int
 	// Failed is the number of tests that failed.
 	Failed int
+	// Cancelled is the number of tests that were not run because the run was cancelled.
+	Cancelled int
+	// Skipped is the number of tests that were skipped.
+	Skipped int
+	// Flaky is the number of tests that only passed once they were retried.
+	Flaky int
+	// Profile is the name of the profile that was run, if any.
+	Profile string
 }
 
 // TruncatedTimestamp returns the started timestamp truncated to second precision.
@@ -48,31 +62,47 @@ func (s Summary) TruncatedTimestamp() time.Time {
 	return s.Started.Truncate(time.Second)
 }
 
-// SetDB sets the datastore to use for test reports.
+// SetDB sets the datastore to use for test reports of the default suite.
 // This must be called during application startup.
 func SetDB(db DB) {
-	instance.db = db
+	instance.SetDB(db)
 }
 
-// SaveResult saves the provided result to the registered datastore.
+// SetDB sets the datastore to use for test reports of s.
+// This must be called during application startup.
+func (s *Suite) SetDB(db DB) {
+	s.db = db
+}
+
+// SaveResult saves the provided result to the datastore registered with SetDB.
 // If no datastore has been registered, an error wrapping ErrNoDB is returned.
 func SaveResult(ctx context.Context, tr TestResult) (string, error) {
-	if instance.db == nil {
+	return instance.SaveResult(ctx, tr)
+}
+
+// SaveResult is like the package-level SaveResult, but uses the datastore of s.
+func (s *Suite) SaveResult(ctx context.Context, tr TestResult) (string, error) {
+	if s.db == nil {
 		return "", fmt.Errorf("%w", ErrNoDB)
 	}
 
-	return instance.db.Save(ctx, tr)
+	return s.db.Save(ctx, tr)
 }
 
-// LoadResult loads the specified result from the registered datastore.
+// LoadResult loads the specified result from the datastore registered with SetDB.
 // If no datastore has been registered, an error wrapping ErrNoDB is returned.
 // If the ID is invalid, an error wrapping ErrNotFound is returned.
 func LoadResult(ctx context.Context, id string) (TestResult, error) {
-	if instance.db == nil {
+	return instance.LoadResult(ctx, id)
+}
+
+// LoadResult is like the package-level LoadResult, but uses the datastore of s.
+func (s *Suite) LoadResult(ctx context.Context, id string) (TestResult, error) {
+	if s.db == nil {
 		return TestResult{}, fmt.Errorf("%w", ErrNoDB)
 	}
 
-	return instance.db.Load(ctx, id)
+	return s.db.Load(ctx, id)
 }
 
 // InMemoryDB is an implementation of DB that is stored in memory, with no persistent storage.
@@ -83,18 +113,34 @@ type InMemoryDB struct {
 }
 
 var _ DB = (*InMemoryDB)(nil)
+var _ ProfileEnumerator = (*InMemoryDB)(nil)
 
 func (db *InMemoryDB) Enumerate(_ context.Context, _ int) (results []Summary, more bool, err error) {
+	return db.enumerate(func(TestResult) bool { return true })
+}
+
+func (db *InMemoryDB) EnumerateProfile(_ context.Context, profile string, _ int) (results []Summary, more bool, err error) {
+	return db.enumerate(func(r TestResult) bool { return r.Profile == profile })
+}
+
+func (db *InMemoryDB) enumerate(include func(TestResult) bool) (results []Summary, more bool, err error) {
 	s := make([]Summary, 0, len(db.store))
 	db.store.Iterate(func(id string, r TestResult) bool {
-		total, passed, failed := r.SumTestStats()
+		if !include(r) {
+			return true
+		}
+		stats := r.Stats()
 		s = append(s, Summary{
-			ID:      id,
-			Started: r.Started,
-			Dur:     r.Dur,
-			Total:   total,
-			Passed:  passed,
-			Failed:  failed,
+			ID:        id,
+			Started:   r.Started,
+			Dur:       r.Dur,
+			Total:     stats.Total,
+			Passed:    stats.Passed,
+			Failed:    stats.Failed,
+			Cancelled: stats.Cancelled,
+			Skipped:   stats.Skipped,
+			Flaky:     stats.Flaky,
+			Profile:   r.Profile,
 		})
 		return true
 	})
@@ -1,12 +1,16 @@
 package testy
 
 import (
+	"context"
 	"embed"
 	"errors"
+	"fmt"
 	"html/template"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -16,18 +20,27 @@ import (
 var templateData embed.FS
 
 type listResultsCtx struct {
-	echo      *echo.Echo
-	Results   []Summary
-	PrevPages []int
-	Page      int
-	NextPage  int
-	More      bool
+	// resultsPath is the path that the routes for individual results are under.
+	resultsPath string
+	Profile     string
+	Results     []Summary
+	PrevPages   []int
+	Page        int
+	NextPage    int
+	More        bool
 }
 
 type showResultCtx struct {
 	Result TestResult
 }
 
+type listTestsCtx struct {
+	// runPath is the path of the route that runs tests.
+	runPath string
+	Profile string
+	Catalog Catalog
+}
+
 type echoRenderer struct {
 	templates *template.Template
 }
@@ -51,36 +64,97 @@ func EchoRenderer() (echo.Renderer, error) {
 	return echoRenderer{templates: tpl}, nil
 }
 
-// AddEchoRoutes adds routes to an Echo router that can run tests and retrieve tests results.
+// AddEchoRoutes adds routes to an Echo router that can run the tests of the default suite and retrieve tests results.
+//
+// The `/run` route runs every registered test, or the profile registered with RegisterProfile named by the `profile`
+// query parameter. The `packages` and `run` query parameters select tests the same as RunOptions.Packages and
+// RunOptions.Run, and the `failfast`, `count`, `countconcurrency` and `capturelog` query parameters set
+// RunOptions.FailFast, RunOptions.Count, RunOptions.CountConcurrency and RunOptions.CaptureLog,
+// overriding those of the profile.
+// The `/results` route lists past results, optionally only those of the profile named by the `profile`
+// query parameter if the DB implements ProfileEnumerator.
+// The `/tests` route lists the registered tests without running them, as returned by ListTests, optionally only
+// those that the profile named by the `profile` query parameter would run, with links to run each one.
+// Both `/results/:id` and `/tests` return JSON instead of HTML if the `raw` query parameter is true.
 func AddEchoRoutes(router *echo.Group) {
-	router.GET("/run", runTests)
+	instance.AddEchoRoutes(router)
+}
+
+// AddEchoRoutes is like the package-level AddEchoRoutes, but for the tests, profiles and datastore of s.
+// Each Suite must be given its own router group.
+func (s *Suite) AddEchoRoutes(router *echo.Group) {
+	router.GET("/run", s.runTests)
+	router.GET("/tests", s.listTests)
 
 	results := router.Group("/results")
-	results.GET("", listResults)
-	results.GET("/", listResults)
-	results.GET("/:id", showResult).Name = "showResult"
+	results.GET("", s.listResults)
+	results.GET("/", s.listResults)
+	results.GET("/:id", s.showResult)
 }
 
-func runTests(c echo.Context) error {
-	results := Run()
+func (s *Suite) runTests(c echo.Context) error {
+	req := struct {
+		Profile          string `query:"profile"`
+		Packages         string `query:"packages"`
+		Run              string `query:"run"`
+		FailFast         int    `query:"failfast"`
+		Count            int    `query:"count"`
+		CountConcurrency int    `query:"countconcurrency"`
+		CaptureLog       bool   `query:"capturelog"`
+	}{}
+	err := c.Bind(&req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	opts, ok := s.profileOptions(req.Profile)
+	if !ok {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("unknown profile %q", req.Profile))
+	}
+	if req.Packages != "" {
+		opts.Packages = req.Packages
+	}
+	if req.Run != "" {
+		opts.Run = req.Run
+	}
+	if req.FailFast > 0 {
+		opts.FailFast = req.FailFast
+	}
+	if req.Count > 0 {
+		opts.Count = req.Count
+	}
+	if req.CountConcurrency > 0 {
+		opts.CountConcurrency = req.CountConcurrency
+	}
+	if req.CaptureLog {
+		opts.CaptureLog = true
+	}
+
+	// stop running tests if the client goes away, since nobody will see the results
+	results, err := s.RunContext(c.Request().Context(), opts)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
 
-	if instance.db != nil {
+	if s.db != nil {
 		// TODO do we want to alert this somehow?
 		// doesn't make sense to return an http error since we do have test results
-		_, _ = SaveResult(c.Request().Context(), results)
+		// save the results even if the client went away, since the tests that did run are still useful
+		_, _ = s.SaveResult(context.WithoutCancel(c.Request().Context()), results)
 	}
 
 	// TODO convert results into a better format?
 	return c.JSON(http.StatusOK, results)
 }
 
-func listResults(c echo.Context) error {
-	if instance.db == nil {
+func (s *Suite) listResults(c echo.Context) error {
+	if s.db == nil {
 		return c.String(http.StatusInternalServerError, "No test result database configured.")
 	}
 
 	req := struct {
-		Page int `query:"page"`
+		Page    int    `query:"page"`
+		Profile string `query:"profile"`
 	}{}
 	err := c.Bind(&req)
 	if err != nil {
@@ -94,7 +168,17 @@ func listResults(c echo.Context) error {
 		req.Page = 1
 	}
 
-	results, more, err := instance.db.Enumerate(c.Request().Context(), req.Page)
+	var results []Summary
+	var more bool
+	if req.Profile == "" {
+		results, more, err = s.db.Enumerate(c.Request().Context(), req.Page)
+	} else {
+		pe, ok := s.db.(ProfileEnumerator)
+		if !ok {
+			return c.String(http.StatusBadRequest, "The test result database does not support filtering by profile.")
+		}
+		results, more, err = pe.EnumerateProfile(c.Request().Context(), req.Profile, req.Page)
+	}
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
@@ -105,17 +189,18 @@ func listResults(c echo.Context) error {
 	}
 
 	return c.Render(http.StatusOK, "result_list.gohtml", listResultsCtx{
-		echo:      c.Echo(),
-		Results:   results,
-		More:      more,
-		PrevPages: prevPages,
-		Page:      req.Page,
-		NextPage:  req.Page + 1,
+		resultsPath: strings.TrimSuffix(c.Path(), "/"),
+		Profile:     req.Profile,
+		Results:     results,
+		More:        more,
+		PrevPages:   prevPages,
+		Page:        req.Page,
+		NextPage:    req.Page + 1,
 	})
 }
 
-func showResult(c echo.Context) error {
-	if instance.db == nil {
+func (s *Suite) showResult(c echo.Context) error {
+	if s.db == nil {
 		return c.String(http.StatusInternalServerError, "No test result database configured.")
 	}
 
@@ -128,7 +213,7 @@ func showResult(c echo.Context) error {
 		return c.String(http.StatusBadRequest, err.Error())
 	}
 
-	tr, err := LoadResult(c.Request().Context(), req.ID)
+	tr, err := s.LoadResult(c.Request().Context(), req.ID)
 	if errors.Is(err, ErrNotFound) {
 		return c.NoContent(http.StatusNotFound)
 	}
@@ -146,8 +231,57 @@ func showResult(c echo.Context) error {
 	})
 }
 
+func (s *Suite) listTests(c echo.Context) error {
+	req := struct {
+		Profile string `query:"profile"`
+		Raw     bool   `query:"raw"`
+	}{}
+	err := c.Bind(&req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	opts, ok := s.profileOptions(req.Profile)
+	if !ok {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("unknown profile %q", req.Profile))
+	}
+
+	catalog, err := s.ListTests(opts)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	if req.Raw {
+		return c.JSON(http.StatusOK, catalog)
+	}
+
+	return c.Render(http.StatusOK, "catalog.gohtml", listTestsCtx{
+		runPath: strings.TrimSuffix(c.Path(), "/tests") + "/run",
+		Profile: req.Profile,
+		Catalog: catalog,
+	})
+}
+
+// profileOptions returns the options of the named profile, or the zero value options if name is empty.
+func (s *Suite) profileOptions(name string) (RunOptions, bool) {
+	if name == "" {
+		return RunOptions{}, true
+	}
+	return s.ProfileOptions(name)
+}
+
+// LinkToRun returns a link to the route that runs only the given test, or every test in the package if name is empty.
+func (c listTestsCtx) LinkToRun(pkg, name string) string {
+	q := url.Values{}
+	q.Set("packages", "^"+regexp.QuoteMeta(pkg)+"$")
+	if name != "" {
+		q.Set("run", "^"+regexp.QuoteMeta(name)+"$")
+	}
+	return c.runPath + "?" + q.Encode()
+}
+
 func (c listResultsCtx) LinkForID(id string) string {
-	return c.echo.Reverse("showResult", id)
+	return c.resultsPath + "/" + url.PathEscape(id)
 }
 
 var anchorRegex = regexp.MustCompile(`[^a-zA-Z0-9._:/'()-]`)
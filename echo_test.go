@@ -1,10 +1,16 @@
 package testy
 
 import (
+	"encoding/json"
 	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTemplates(t *testing.T) {
@@ -15,3 +21,171 @@ func TestTemplates(t *testing.T) {
 	_, err := tpl.ParseFS(templateData, "templates/*.gohtml")
 	assert.NoError(t, err)
 }
+
+func TestRunTestsProfile(t *testing.T) {
+	instance = &Suite{}
+
+	Test("test", func(TestingT) {})
+	RegisterProfile("smoke", RunOptions{})
+
+	e := echo.New()
+	AddEchoRoutes(e.Group(""))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/run?profile=nightly", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/run?profile=smoke", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res TestResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, "smoke", res.Profile)
+	assert.Equal(t, ResultPassed, res.Result)
+}
+
+func TestAddEchoRoutesSuites(t *testing.T) {
+	instance = &Suite{}
+
+	var public, partner Suite
+	public.Test("public", func(TestingT) {})
+	partner.Test("partner", func(t TestingT) { t.Errorf("failed") })
+	public.SetDB(&InMemoryDB{})
+	partner.SetDB(&InMemoryDB{})
+
+	e := echo.New()
+	e.Renderer, _ = EchoRenderer()
+	public.AddEchoRoutes(e.Group("/public"))
+	partner.AddEchoRoutes(e.Group("/partner"))
+
+	for prefix, result := range map[string]Result{"/public": ResultPassed, "/partner": ResultFailed} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, prefix+"/run", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var res TestResult
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, result, res.Result, prefix)
+		require.Len(t, res.Subtests, 1, prefix)
+		require.Len(t, res.Subtests[0].Subtests, 1, prefix)
+		assert.Equal(t, strings.TrimPrefix(prefix, "/"), res.Subtests[0].Subtests[0].Name)
+
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, prefix+"/results", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `href="`+prefix+`/results/0"`, prefix)
+
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, prefix+"/results/0?raw=true", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var saved TestResult
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &saved))
+		assert.Equal(t, result, saved.Result, prefix)
+	}
+}
+
+func TestListTestsRoute(t *testing.T) {
+	instance = &Suite{}
+
+	var ran []string
+	Test("smoke test", recordName(&ran), Tags("smoke"))
+	Test("slow", recordName(&ran))
+	RegisterProfile("smoke", RunOptions{Tags: []string{"smoke"}})
+
+	e := echo.New()
+	e.Renderer, _ = EchoRenderer()
+	AddEchoRoutes(e.Group("/testy"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testy/tests?profile=smoke&raw=true", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var catalog Catalog
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &catalog))
+	require.Len(t, catalog.Packages, 1)
+	require.Len(t, catalog.Packages[0].Tests, 1)
+	assert.Equal(t, "smoke_test", catalog.Packages[0].Tests[0].Name)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testy/tests?profile=nightly", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testy/tests", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, ran, "listing does not run anything")
+
+	// follow the link to run a single test
+	link := listTestsCtx{runPath: "/testy/run"}.LinkToRun("github.com/gametimesf/testy", "slow")
+	assert.Contains(t, rec.Body.String(), template.HTMLEscapeString(link))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"slow"}, ran)
+}
+
+func TestRunTestsFailFast(t *testing.T) {
+	instance = &Suite{}
+
+	Test("a", func(t TestingT) { t.FailNow() })
+	Test("b", func(TestingT) {})
+
+	e := echo.New()
+	AddEchoRoutes(e.Group(""))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/run?failfast=1", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res TestResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Len(t, res.Subtests, 1)
+	require.Len(t, res.Subtests[0].Subtests, 2)
+	assert.Equal(t, ResultCancelled, res.Subtests[0].Subtests[1].Result)
+}
+
+func TestRunTestsCount(t *testing.T) {
+	instance = &Suite{}
+
+	Test("a", func(TestingT) {})
+
+	e := echo.New()
+	AddEchoRoutes(e.Group(""))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/run?count=3&countconcurrency=3", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res TestResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Len(t, res.Subtests, 1)
+	require.Len(t, res.Subtests[0].Subtests, 1)
+	assert.Len(t, res.Subtests[0].Subtests[0].Subtests, 3)
+	require.NotNil(t, res.Subtests[0].Subtests[0].Iterations)
+	assert.Equal(t, 3, res.Subtests[0].Subtests[0].Iterations.Passed)
+}
+
+func TestShowResultMsgs(t *testing.T) {
+	instance = &Suite{}
+
+	Test("logs", func(t TestingT) {
+		t.Logger().Debug("request dump", "method", "GET")
+		t.Errorf("failed")
+	})
+	SetDB(&InMemoryDB{})
+
+	e := echo.New()
+	e.Renderer, _ = EchoRenderer()
+	AddEchoRoutes(e.Group(""))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/run", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/results/0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `id="show-debug"`)
+	assert.Contains(t, body, `<tr class="msg-debug">`)
+	assert.Contains(t, body, `<strong>method</strong>=GET`)
+	assert.Contains(t, body, `<tr class="msg-error">`)
+	assert.Regexp(t, `>echo_test.go:\d+</span>`, body)
+}
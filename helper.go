@@ -2,15 +2,39 @@ package testy
 
 import (
 	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"slices"
 )
 
 // TestEach runs tester as a subtest for each value in values.
 // The values should have a good default string representation so the subtest names are legible.
 // Consider implementing fmt.Stringer for complex structs.
+//
+// When run via Run with RunOptions.ShuffleSubtests, the subtests are run in a random order.
 func TestEach[V any](t TestingT, values []V, tester func(TestingT, V)) {
-	for _, v := range values {
+	for _, v := range subtestOrder(t, values) {
 		t.Run(fmt.Sprintf("%v", v), func(t TestingT) {
 			tester(t, v)
 		})
 	}
 }
+
+// subtestOrder returns values in the order that their subtests should be run in.
+func subtestOrder[V any](tt TestingT, values []V) []V {
+	st, ok := tt.(*t)
+	if !ok || st.cfg == nil || !st.cfg.shuffle || !st.cfg.shuffleSubtests {
+		return values
+	}
+
+	// derive the seed from the test's name so the order does not depend on what else is running concurrently
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(st.pkg + "." + st.name))
+	rng := rand.New(rand.NewSource(st.cfg.seed ^ int64(h.Sum64())))
+
+	shuffled := slices.Clone(values)
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
@@ -0,0 +1,83 @@
+package testy
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+// msgHandler is a slog.Handler that adds records to a test's messages.
+type msgHandler struct {
+	t *t
+	// attrs are the attributes added by WithAttrs, already qualified by their groups.
+	attrs []Attr
+	// prefix qualifies the keys of attributes with the groups added by WithGroup, such as "request.".
+	prefix string
+}
+
+var _ slog.Handler = (*msgHandler)(nil)
+
+// Enabled keeps records at every level, so that debug messages are available when a test fails.
+func (h *msgHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *msgHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := slices.Clip(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = appendAttr(attrs, h.prefix, a)
+		return true
+	})
+	h.t.log(levelFromSlog(r.Level), r.Message, attrs...)
+	return nil
+}
+
+func (h *msgHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = slices.Clip(h.attrs)
+	for _, a := range as {
+		h2.attrs = appendAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *msgHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix += name + "."
+	return &h2
+}
+
+// appendAttr appends a to attrs with its key qualified by prefix, flattening groups the same way as slog.TextHandler.
+func appendAttr(attrs []Attr, prefix string, a slog.Attr) []Attr {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return attrs
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			attrs = appendAttr(attrs, prefix, ga)
+		}
+		return attrs
+	}
+	return append(attrs, Attr{Key: prefix + a.Key, Value: a.Value.String()})
+}
+
+// levelFromSlog maps a slog level onto the closest Level at or below it.
+func levelFromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
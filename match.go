@@ -0,0 +1,118 @@
+package testy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// filter selects tests by name using the same slash-separated regular expression semantics as `go test -run`.
+// A nil filter matches everything.
+type filter []filterAlternative
+
+// filterAlternative is a single top-level alternative (separated by |) of a filter.
+// Each element is matched against the corresponding slash-separated element of a test's name.
+type filterAlternative []*regexp.Regexp
+
+// newFilter parses pattern into a filter. An empty pattern results in a nil filter that matches everything.
+func newFilter(pattern string) (filter, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	var f filter
+	for i, alt := range splitPattern(pattern) {
+		fa := make(filterAlternative, 0, len(alt))
+		for j, elem := range alt {
+			re, err := regexp.Compile(strings.Map(rewritePatternRune, elem))
+			if err != nil {
+				return nil, fmt.Errorf("alternation %d element %d of %q: %w", i, j, pattern, err)
+			}
+			fa = append(fa, re)
+		}
+		f = append(f, fa)
+	}
+	return f, nil
+}
+
+// matches reports whether the test with the provided slash-separated name is selected by the filter.
+// If partial is true, the name only matched a prefix of the pattern's elements,
+// so the test must still be run to find out whether any of its subtests will fully match.
+func (f filter) matches(name string) (ok, partial bool) {
+	if f == nil {
+		return true, false
+	}
+
+	elems := strings.Split(name, "/")
+	for _, alt := range f {
+		if ok, partial = alt.matches(elems); ok {
+			return ok, partial
+		}
+	}
+	return false, false
+}
+
+func (fa filterAlternative) matches(elems []string) (ok, partial bool) {
+	for i, elem := range elems {
+		if i >= len(fa) {
+			break
+		}
+		if !fa[i].MatchString(elem) {
+			return false, false
+		}
+	}
+	return true, len(elems) < len(fa)
+}
+
+// splitPattern splits pattern into its top-level alternatives and each of those into its slash-separated elements.
+// Slashes and pipes inside of brackets or parentheses do not split the pattern, matching `go test -run`.
+func splitPattern(s string) [][]string {
+	var alts [][]string
+	var elems []string
+	brackets := 0
+	parens := 0
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '[':
+			brackets++
+		case ']':
+			// an unmatched ']' is legal
+			if brackets--; brackets < 0 {
+				brackets = 0
+			}
+		case '(':
+			if brackets == 0 {
+				parens++
+			}
+		case ')':
+			if brackets == 0 {
+				parens--
+			}
+		case '\\':
+			i++
+		case '/', '|':
+			if brackets == 0 && parens == 0 {
+				elems = append(elems, s[:i])
+				if s[i] == '|' {
+					alts = append(alts, elems)
+					elems = nil
+				}
+				s = s[i+1:]
+				i = 0
+				continue
+			}
+		}
+		i++
+	}
+	return append(alts, append(elems, s))
+}
+
+// rewritePatternRune replaces whitespace in a pattern the same way sanitizeName does for test names,
+// so patterns can be written using the names as they were passed to Test or Run.
+func rewritePatternRune(r rune) rune {
+	if unicode.IsSpace(r) {
+		return '_'
+	}
+	return r
+}
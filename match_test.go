@@ -0,0 +1,58 @@
+package testy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPattern(t *testing.T) {
+	assert.Equal(t, [][]string{{"a"}}, splitPattern("a"))
+	assert.Equal(t, [][]string{{"a", "b", "c"}}, splitPattern("a/b/c"))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, splitPattern("a/b|c"))
+	assert.Equal(t, [][]string{{"a[/|]", "(b|c)"}}, splitPattern("a[/|]/(b|c)"))
+	assert.Equal(t, [][]string{{`a\/b`}}, splitPattern(`a\/b`))
+}
+
+func TestFilter(t *testing.T) {
+	f, err := newFilter("")
+	require.NoError(t, err)
+	ok, partial := f.matches("anything/at/all")
+	assert.True(t, ok)
+	assert.False(t, partial)
+
+	f, err = newFilter("^Fibonacci number$/^5$")
+	require.NoError(t, err)
+
+	ok, partial = f.matches("Fibonacci_number")
+	assert.True(t, ok)
+	assert.True(t, partial)
+
+	ok, partial = f.matches("Fibonacci_number/5")
+	assert.True(t, ok)
+	assert.False(t, partial)
+
+	ok, _ = f.matches("Fibonacci_number/6")
+	assert.False(t, ok)
+
+	ok, _ = f.matches("70th_Fibonacci_number")
+	assert.False(t, ok)
+
+	// deeper subtests of a fully matched test are always selected
+	ok, partial = f.matches("Fibonacci_number/5/deeper")
+	assert.True(t, ok)
+	assert.False(t, partial)
+
+	f, err = newFilter("^a$|^b$/c")
+	require.NoError(t, err)
+	ok, _ = f.matches("a/anything")
+	assert.True(t, ok)
+	ok, _ = f.matches("b/c")
+	assert.True(t, ok)
+	ok, _ = f.matches("b/d")
+	assert.False(t, ok)
+
+	_, err = newFilter("a/(")
+	assert.Error(t, err)
+}
@@ -0,0 +1,284 @@
+package testy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RunOptions controls which registered tests are executed by RunWithOptions and how they are executed.
+// The zero value runs every registered test, which is what Run does.
+type RunOptions struct {
+	// Packages is a regular expression selecting which packages to run.
+	// It is matched against the full import path of each package, and is not anchored.
+	// An empty string selects every package.
+	Packages string
+	// Run selects which tests to run, with the same semantics as the `go test -run` flag.
+	// It is split by unbracketed slashes into a sequence of regular expressions,
+	// and each one must match the corresponding part of a test's name (the registered test name, then each subtest name).
+	// Subtests created by TestingT.Run or TestEach are filtered as well.
+	// An empty string selects every test.
+	Run string
+	// PackageConcurrency is the maximum number of packages that may be run at the same time, like the `go test -p` flag.
+	// Each package still runs its own BeforePackage and AfterPackage functions around only its own tests.
+	// Only set this if the tests in different packages do not interfere with each other.
+	// If this is zero or negative, packages are run one at a time.
+	PackageConcurrency int
+	// Parallel is the maximum number of tests within a package that may run in parallel at the same time,
+	// like the `go test -parallel` flag. Only tests that call TestingT.Parallel are run in parallel.
+	// If this is zero or negative, it defaults to GOMAXPROCS.
+	Parallel int
+	// Shuffle randomizes the execution order of packages and of the top level tests within each package,
+	// like the `go test -shuffle` flag.
+	// It may be "off" (or empty), "on" to use the current time as the seed, or an integer to use as the seed.
+	// The seed that was used is recorded in TestResult.Shuffle so that the same order can be run again.
+	Shuffle string
+	// ShuffleSubtests additionally randomizes the order in which TestEach runs its subtests.
+	// The order of each TestEach only depends on the seed and the name of the test calling it,
+	// so it is reproducible even when tests are run in parallel.
+	// It has no effect if Shuffle is off.
+	ShuffleSubtests bool
+	// Timeout is how long each registered test may run for, including its subtests and its BeforeTest and AfterTest.
+	// A test that runs for longer is marked as failed with a dump of its goroutine's stack and abandoned,
+	// and the run continues with the next test.
+	// Time spent waiting in TestingT.Parallel for other tests to finish does not count.
+	// This may be overridden for a package with PackageTimeout, and for a single test with the Timeout option.
+	// If this is zero or negative, tests do not time out.
+	Timeout time.Duration
+	// Retries is how many more times a registered test is run if it fails, which is useful when tests depend on
+	// external services that have transient failures.
+	// A test that passes once it is retried is marked as ResultFlaky, which does not fail the run,
+	// and the result of each attempt that failed is recorded in its TestResult.Attempts.
+	// Each attempt runs the test's BeforeTest and AfterTest again, and its subtests are not retried individually.
+	// Tests are not retried once the run has been cancelled.
+	// This may be overridden for a package with PackageRetries, and for a single test with the Retries option.
+	// If this is zero or negative, tests are not retried.
+	Retries int
+	// Count is how many times each selected registered test is run, like the `go test -count` flag,
+	// which is useful for chasing intermittent failures.
+	// Each iteration is recorded as a subtest of the test named by its number, such as "#01",
+	// and the test's TestResult.Iterations summarizes their pass rate and durations.
+	// Every iteration runs the test's BeforeTest and AfterTest, and the test's timeout applies to each iteration.
+	// Repeated tests are not retried, and RunOptions.Run matches the subtests of each iteration as if it was not there.
+	// If the test calls TestingT.Parallel, the repeated test as a whole runs in parallel with the package's other
+	// parallel tests, but its iterations are still limited by CountConcurrency.
+	// If this is one or less, each test is run once.
+	Count int
+	// CountConcurrency is the maximum number of iterations of a test that may run at the same time when Count is set.
+	// Only set this if the test does not interfere with itself.
+	// If this is zero or negative, iterations are run one at a time.
+	CountConcurrency int
+	// FailFast stops the run once this many registered tests have failed, like the `go test -failfast` flag
+	// does after the first one, which is useful when only whether anything is broken matters.
+	// Tests that have already started are still finished, along with their AfterTest and their package's AfterPackage,
+	// but no more tests or packages are started, and no more retries are made.
+	// The tests that were not run are marked as ResultCancelled.
+	// Failures are counted across all packages, and only once a test has no retries left.
+	// If this is zero or negative, the run does not stop because of failures.
+	FailFast int
+	// CaptureLog adds the output of the standard log package to the messages of the test that produced it,
+	// instead of writing it to the standard logger's output, while the run is in progress.
+	// Output is attributed to the test or Before/After function running in the goroutine that logged it,
+	// so this works the same however many tests run concurrently.
+	// Output from any other goroutine, including those started by tests and the rest of the program,
+	// still goes to the standard logger's output.
+	// Only the standard logger is captured, not loggers created with log.New or writes to os.Stdout and os.Stderr;
+	// pass TestingT.Output to those to capture their output instead.
+	CaptureLog bool
+	// Tags selects only the tests that have at least one of these tags, as set by the Tags option.
+	// If it is empty, tests are not selected by their tags.
+	Tags []string
+	// Owners selects only the tests that are owned by one of these owners, as set by the Owner option.
+	// If it is empty, tests are not selected by their owner.
+	Owners []string
+	// Profile is the name of the profile these options are for, which is recorded in TestResult.Profile.
+	// It is set on the options returned by ProfileOptions, and does not otherwise change what is run.
+	Profile string
+}
+
+// RegisterProfile registers a named set of options, such as "smoke" or "nightly",
+// so that they can be run by name with ProfileOptions or the `/run?profile=` route added by AddEchoRoutes.
+// Each profile may only be registered once.
+// It should be called during application startup.
+func RegisterProfile(name string, opts RunOptions) {
+	instance.RegisterProfile(name, opts)
+}
+
+// RegisterProfile is like the package-level RegisterProfile, but registers the profile with s.
+func (s *Suite) RegisterProfile(name string, opts RunOptions) {
+	if name == "" {
+		panic("profile name must not be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.profiles[name]; exists {
+		panic(fmt.Sprintf("profile %s already exists", name))
+	}
+	if _, err := opts.parse(); err != nil {
+		panic(fmt.Sprintf("profile %s has invalid options: %v", name, err))
+	}
+
+	if s.profiles == nil {
+		s.profiles = make(map[string]RunOptions)
+	}
+	opts.Profile = name
+	s.profiles[name] = opts
+}
+
+// ProfileOptions returns the options of the profile registered with RegisterProfile,
+// or false if there is no profile with that name.
+func ProfileOptions(name string) (RunOptions, bool) {
+	return instance.ProfileOptions(name)
+}
+
+// ProfileOptions is like the package-level ProfileOptions, but for the profiles registered with s.
+func (s *Suite) ProfileOptions(name string) (RunOptions, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	opts, ok := s.profiles[name]
+	return opts, ok
+}
+
+// runConfig is the parsed form of RunOptions.
+type runConfig struct {
+	packages           *regexp.Regexp
+	run                filter
+	packageConcurrency int
+	parallel           int
+	shuffle            bool
+	seed               int64
+	shuffleSubtests    bool
+	timeout            time.Duration
+	retries            int
+	count              int
+	countConcurrency   int
+	failFast           int
+	// failures is the number of registered tests that have failed so far, for failFast.
+	// It is shared by every copy of the config.
+	failures   *atomic.Int32
+	captureLog bool
+	tags       []string
+	owners     []string
+	profile    string
+
+	// events receives the progress of the run. It is nil if nothing is listening.
+	events *eventStream
+}
+
+func (opts RunOptions) parse() (runConfig, error) {
+	var cfg runConfig
+	var err error
+
+	if opts.Packages != "" {
+		cfg.packages, err = regexp.Compile(opts.Packages)
+		if err != nil {
+			return runConfig{}, fmt.Errorf("invalid package pattern: %w", err)
+		}
+	}
+
+	cfg.run, err = newFilter(opts.Run)
+	if err != nil {
+		return runConfig{}, fmt.Errorf("invalid test pattern: %w", err)
+	}
+
+	cfg.packageConcurrency = opts.PackageConcurrency
+	if cfg.packageConcurrency < 1 {
+		cfg.packageConcurrency = 1
+	}
+
+	cfg.parallel = opts.Parallel
+	if cfg.parallel < 1 {
+		cfg.parallel = runtime.GOMAXPROCS(0)
+	}
+
+	cfg.shuffle, cfg.seed, err = parseShuffle(opts.Shuffle)
+	if err != nil {
+		return runConfig{}, err
+	}
+	cfg.shuffleSubtests = opts.ShuffleSubtests
+	cfg.timeout = opts.Timeout
+	cfg.retries = opts.Retries
+	cfg.count = opts.Count
+	cfg.countConcurrency = max(opts.CountConcurrency, 1)
+	cfg.failFast = opts.FailFast
+	cfg.failures = new(atomic.Int32)
+	cfg.captureLog = opts.CaptureLog
+	cfg.tags = opts.Tags
+	cfg.owners = opts.Owners
+	cfg.profile = opts.Profile
+
+	return cfg, nil
+}
+
+// parseShuffle parses a shuffle setting with the same format as the `go test -shuffle` flag.
+func parseShuffle(s string) (shuffle bool, seed int64, err error) {
+	switch s {
+	case "", "off":
+		return false, 0, nil
+	case "on":
+		return true, time.Now().UnixNano(), nil
+	}
+
+	seed, err = strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("invalid shuffle value %q: must be \"off\", \"on\", or an integer", s)
+	}
+	return true, seed, nil
+}
+
+// testTimeout returns the timeout for a registered test, which is the most specific one that has been set.
+func (cfg runConfig) testTimeout(pkgTests *testPkg, test testCase) time.Duration {
+	if test.timeout > 0 {
+		return test.timeout
+	}
+	if pkgTests.timeout > 0 {
+		return pkgTests.timeout
+	}
+	return cfg.timeout
+}
+
+// stopped returns why no more tests may be started, if ctx is done or FailFast has been reached.
+func (cfg *runConfig) stopped(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cfg.failFast > 0 && int(cfg.failures.Load()) >= cfg.failFast {
+		return fmt.Errorf("the run was stopped by FailFast after %d failed test(s)", cfg.failFast)
+	}
+	return nil
+}
+
+// testRetries returns how many times a registered test may be retried, which is the most specific one that has been set.
+func (cfg runConfig) testRetries(pkgTests *testPkg, test testCase) int {
+	if test.retries > 0 {
+		return test.retries
+	}
+	if pkgTests.retries > 0 {
+		return pkgTests.retries
+	}
+	return cfg.retries
+}
+
+// selectsPackage reports whether the package with the provided import path should be run.
+func (cfg runConfig) selectsPackage(pkg string) bool {
+	return cfg.packages == nil || cfg.packages.MatchString(pkg)
+}
+
+// selectsMetadata reports whether a test with the provided metadata should be run.
+func (cfg runConfig) selectsMetadata(m Metadata) bool {
+	if len(cfg.tags) > 0 && !slices.ContainsFunc(cfg.tags, m.HasTag) {
+		return false
+	}
+	if len(cfg.owners) > 0 && !slices.Contains(cfg.owners, m.Owner) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package testy
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"sync"
+)
+
+// lineWriter is an io.Writer that calls log with each complete line written to it, including its newline.
+type lineWriter struct {
+	log func(line string)
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.buf = append(w.buf, p...)
+	var lines []string
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, string(w.buf[:i+1]))
+		w.buf = w.buf[i+1:]
+	}
+	w.mu.Unlock()
+
+	for _, line := range lines {
+		w.log(line)
+	}
+	return len(p), nil
+}
+
+// flush logs whatever has been written since the last newline, if anything.
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	rest := w.buf
+	w.buf = nil
+	w.mu.Unlock()
+
+	if len(rest) > 0 {
+		w.log(string(rest))
+	}
+}
+
+// logCapture is the output of the standard logger while any run with RunOptions.CaptureLog is in progress.
+// It is shared by every run, since the standard logger is.
+var logCapture = &logCapturer{}
+
+// logCapturer adds the output of the standard logger to the messages of the test that produced it.
+// The test is found by the goroutine that wrote the output. Output from any other goroutine is written to the standard
+// logger's previous output, since it may well not be from a test at all, such as a Stream consumer logging events.
+type logCapturer struct {
+	// runsMu guards runs. It is separate from mu because the standard logger holds its own lock while calling Write,
+	// so log.SetOutput must not be called while holding mu.
+	runsMu sync.Mutex
+	// runs is the number of runs that are capturing the standard logger's output.
+	runs int
+
+	mu sync.Mutex
+	// prev is the output of the standard logger before the first run started capturing it.
+	prev io.Writer
+	// running are the tests and Before/After functions that are running.
+	running []capturingTest
+}
+
+type capturingTest struct {
+	t         *t
+	goroutine int64
+}
+
+// start captures the output of the standard logger until stop is called.
+func (c *logCapturer) start() {
+	c.runsMu.Lock()
+	defer c.runsMu.Unlock()
+
+	if c.runs == 0 {
+		prev := log.Writer()
+		c.mu.Lock()
+		c.prev = prev
+		c.mu.Unlock()
+		log.SetOutput(c)
+	}
+	c.runs++
+}
+
+// stop restores the output of the standard logger once every run that called start has called stop.
+func (c *logCapturer) stop() {
+	c.runsMu.Lock()
+	defer c.runsMu.Unlock()
+
+	c.runs--
+	if c.runs == 0 {
+		c.mu.Lock()
+		prev := c.prev
+		c.mu.Unlock()
+		log.SetOutput(prev)
+	}
+}
+
+// add receives the output of the standard logger for t, which is running in the calling goroutine, until remove is called.
+func (c *logCapturer) add(t *t) {
+	id := goroutineID()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = append(c.running, capturingTest{t: t, goroutine: id})
+}
+
+func (c *logCapturer) remove(t *t) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, ct := range c.running {
+		if ct.t == t {
+			c.running = append(c.running[:i], c.running[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *logCapturer) Write(p []byte) (int, error) {
+	id := goroutineID()
+	c.mu.Lock()
+	var target *t
+	for _, ct := range c.running {
+		if ct.goroutine == id {
+			target = ct.t
+			break
+		}
+	}
+	prev := c.prev
+	c.mu.Unlock()
+
+	if target == nil {
+		return prev.Write(p)
+	}
+	// the standard logger writes a whole message at a time, so there is no need to split it into lines
+	target.log(LevelInfo, string(p))
+	return len(p), nil
+}
@@ -4,15 +4,17 @@ import (
 	"fmt"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/gametimesf/testy/internal/orderedmap"
 )
 
-// It is assumed that all funcs in this file are called during package initialization,
-// and as such there is a language guarantee that only one such func will be running at a time,
-// so we don't need to synchronize access to the maps containing packages or tests.
-//
-// For more details, see https://go.dev/ref/spec#Package_initialization
+// Most funcs in this file are intended to be called during package initialization, and so panic if they are misused,
+// and use the package of their caller as the package of whatever they register.
+// RegisterTest, RegisterPackageHook and the Unregister funcs are intended to be called at any time instead,
+// such as for tests loaded from data, and so take an explicit package and return an error.
+// Either way, a Suite's registrations are guarded by its mutex, and each run only sees the tests and Before/After
+// functions that were registered when it started.
 
 // Test registers a new test to be run.
 // Tests are run in lexicographical order within a package.
@@ -22,154 +24,428 @@ import (
 // This also means that you need to ensure that your test packages are eventually imported by your main package.
 // You may need to do this with a side effects import (`import _ "my/package"`).
 //
+// Options may be provided to change how the test is run, or to describe it with metadata such as Tags or Owner.
+//
 // The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
 //
 //	var _ = testy.Test("my test", func(t testy.TestingT){})
-func Test(name string, tester Tester) any {
+func Test(name string, tester Tester, opts ...TestOption) any {
+	return must(instance.RegisterTest(getCallerPackage(), name, tester, opts...))
+}
+
+// Test is like the package-level Test, but registers the test with s.
+func (s *Suite) Test(name string, tester Tester, opts ...TestOption) any {
+	return must(s.RegisterTest(getCallerPackage(), name, tester, opts...))
+}
+
+// RegisterTest registers a new test in the package pkg, which need not be a Go package.
+// Unlike Test, it may be called at any time, such as to register tests generated from data loaded at startup,
+// and returns an error instead of panicking if the test cannot be registered.
+// Runs that have already started are not affected.
+func RegisterTest(pkg, name string, tester Tester, opts ...TestOption) error {
+	return instance.RegisterTest(pkg, name, tester, opts...)
+}
+
+// RegisterTest is like the package-level RegisterTest, but registers the test with s.
+func (s *Suite) RegisterTest(pkg, name string, tester Tester, opts ...TestOption) error {
+	if pkg == "" {
+		return fmt.Errorf("test %s has no package", name)
+	}
 	if tester == nil {
-		panic(fmt.Sprintf("test %s has nil test function", name))
+		return fmt.Errorf("test %s has nil test function", name)
 	}
 
 	name = strings.Map(sanitizeName, name)
-	pkg := getCallerPackage()
-	pkgTests := getPackageTests(pkg)
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pkgTests := s.getPackageTests(pkg)
 	if _, exists := pkgTests.tests[name]; exists {
-		panic(fmt.Sprintf("test %s already exists in package %s", name, pkg))
+		return fmt.Errorf("test %s already exists in package %s", name, pkg)
 	}
 
-	pkgTests.tests[name] = testCase{
+	tc := testCase{
 		Package: pkg,
 		Name:    name,
 		tester:  tester,
 	}
+	for _, opt := range opts {
+		opt(&tc)
+	}
+	pkgTests.tests[name] = tc
 
 	return nil
 }
 
+// UnregisterTest removes the test registered in the package pkg with the given name, and reports whether there was one.
+// Runs that have already started are not affected.
+func UnregisterTest(pkg, name string) bool {
+	return instance.UnregisterTest(pkg, name)
+}
+
+// UnregisterTest is like the package-level UnregisterTest, but removes the test from s.
+func (s *Suite) UnregisterTest(pkg, name string) bool {
+	name = strings.Map(sanitizeName, name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pkgTests, exists := s.tests[pkg]
+	if !exists {
+		return false
+	}
+	if _, exists := pkgTests.tests[name]; !exists {
+		return false
+	}
+
+	delete(pkgTests.tests, name)
+	return true
+}
+
+// UnregisterPackage removes every test and Before/After function registered in the package pkg,
+// and reports whether anything was registered in it. Runs that have already started are not affected.
+func UnregisterPackage(pkg string) bool {
+	return instance.UnregisterPackage(pkg)
+}
+
+// UnregisterPackage is like the package-level UnregisterPackage, but removes the package from s.
+func (s *Suite) UnregisterPackage(pkg string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tests[pkg]; !exists {
+		return false
+	}
+
+	delete(s.tests, pkg)
+	return true
+}
+
+// TestOption changes how a test registered with Test is run, or describes it.
+type TestOption func(*testCase)
+
+// Timeout overrides how long the test may run for when run via Run. See RunOptions.Timeout for details.
+// It has no effect when run via RunAsTest; use the standard -timeout test flag instead.
+func Timeout(d time.Duration) TestOption {
+	return func(tc *testCase) {
+		tc.timeout = d
+	}
+}
+
+// Retries overrides how many more times the test is run if it fails when run via Run. See RunOptions.Retries for details.
+// It has no effect when run via RunAsTest.
+func Retries(n int) TestOption {
+	return func(tc *testCase) {
+		tc.retries = n
+	}
+}
+
+// Tags adds tags to the test, such as "smoke" or "payments".
+// Tags are recorded in TestResult.Metadata, and RunOptions.Tags can be used to run only tests with certain tags.
+func Tags(tags ...string) TestOption {
+	return func(tc *testCase) {
+		tc.metadata.Tags = append(tc.metadata.Tags, tags...)
+	}
+}
+
+// Owner sets the team or person that owns the test.
+// It is recorded in TestResult.Metadata, and RunOptions.Owners can be used to run only tests with certain owners.
+func Owner(owner string) TestOption {
+	return func(tc *testCase) {
+		tc.metadata.Owner = owner
+	}
+}
+
+// Description sets a human-readable description of what the test does. It is recorded in TestResult.Metadata.
+func Description(description string) TestOption {
+	return func(tc *testCase) {
+		tc.metadata.Description = description
+	}
+}
+
+// Runbook sets a link to the runbook to follow when the test fails. It is recorded in TestResult.Metadata.
+func Runbook(url string) TestOption {
+	return func(tc *testCase) {
+		tc.metadata.Runbook = url
+	}
+}
+
+// PackageTimeout overrides how long each test in the package may run for when run via Run,
+// unless the test has its own Timeout. See RunOptions.Timeout for details.
+// It has no effect when run via RunAsTest; use the standard -timeout test flag instead.
+//
+// The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
+//
+//	var _ = testy.PackageTimeout(time.Minute)
+func PackageTimeout(d time.Duration) any {
+	return must(instance.setPackageTimeout(getCallerPackage(), d))
+}
+
+// PackageTimeout is like the package-level PackageTimeout, but for the caller's package in s.
+func (s *Suite) PackageTimeout(d time.Duration) any {
+	return must(s.setPackageTimeout(getCallerPackage(), d))
+}
+
+func (s *Suite) setPackageTimeout(pkg string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pkgTests := s.getPackageTests(pkg)
+	if pkgTests.timeout != 0 {
+		return fmt.Errorf("package %s already has a PackageTimeout", pkg)
+	}
+
+	pkgTests.timeout = d
+	return nil
+}
+
+// PackageRetries overrides how many more times each test in the package is run if it fails when run via Run,
+// unless the test has its own Retries. See RunOptions.Retries for details.
+// It has no effect when run via RunAsTest.
+//
+// The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
+//
+//	var _ = testy.PackageRetries(2)
+func PackageRetries(n int) any {
+	return must(instance.setPackageRetries(getCallerPackage(), n))
+}
+
+// PackageRetries is like the package-level PackageRetries, but for the caller's package in s.
+func (s *Suite) PackageRetries(n int) any {
+	return must(s.setPackageRetries(getCallerPackage(), n))
+}
+
+func (s *Suite) setPackageRetries(pkg string, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pkgTests := s.getPackageTests(pkg)
+	if pkgTests.retries != 0 {
+		return fmt.Errorf("package %s already has PackageRetries", pkg)
+	}
+
+	pkgTests.retries = n
+	return nil
+}
+
 // BeforePackage registers a function to be run once before any tests in the given package are run.
 // A package may only have one BeforePackage function.
 //
-// If BeforePackage panics, no tests in the package will be run and the reporting behavior depends on if RunAsTest or Run was called.
+// BeforePackage fails if it panics or marks the provided TestingT as failed (with TestingT.Errorf, TestingT.Fatalf, etc.),
+// just like a test.
+// If BeforePackage fails, no tests in the package will be run and the reporting behavior depends on if RunAsTest or Run was called.
 // AfterPackage will still be run.
+// If BeforePackage calls TestingT.Skip (or a similar method), every test in the package is skipped instead.
 //
-// If RunAsTest was called, the panic will be reported as the top-level bootstrap test for the package.
-// If Run was called, every registered test in the package will be marked as failed with the panic's message.
-//
-// When run via Run, any logging output to the provided Tester will only be visible if BeforePackage panics or the Tester is marked as failed.
-// When run via RunAsTest, the standard `go test` output rules apply.
-// Notably, if a test fails, the output is not visible via Run but is via RunAsTest.
+// If RunAsTest was called, the failure will be reported as the top-level bootstrap test for the package.
+// If Run was called, every registered test in the package will be marked as failed.
 //
-// NOTE: Do not call TestingT.Fail, TestingT.FailNow, TestingT.Fatal, or TestingT.Fatalf in BeforePackage to report errors; always panic.
-// It will work as expected in RunAsTest mode, but not Run mode.
-// TODO parity here.
+// When run via Run, BeforePackage's result, duration and logging output are recorded in the package's TestResult.Hooks.
+// When run via RunAsTest, its logging output is logged by the top-level bootstrap test instead.
 //
 // The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
 //
 //	var _ = testy.BeforePackage(func(){})
 func BeforePackage(f Tester) any {
-	pkg := getCallerPackage()
-	pkgTests := getPackageTests(pkg)
-
-	if pkgTests.BeforePackage != nil {
-		panic(fmt.Sprintf("package %s already has a BeforePackage", pkg))
-	}
+	return must(instance.RegisterPackageHook(getCallerPackage(), HookBeforePackage, f))
+}
 
-	pkgTests.BeforePackage = f
-	return nil
+// BeforePackage is like the package-level BeforePackage, but registers f with s.
+func (s *Suite) BeforePackage(f Tester) any {
+	return must(s.RegisterPackageHook(getCallerPackage(), HookBeforePackage, f))
 }
 
 // AfterPackage registers a function to be run once after all tests in the given package have finished.
 // A package may only have one AfterPackage function.
 //
-// If AfterPackage panics, the reporting behavior depends on if RunAsTest or Run was called.
-// If AfterPackage panics and BeforePackage had already panicked, then the panic for BeforePackage takes priority.
+// AfterPackage fails if it panics or marks the provided TestingT as failed (with TestingT.Errorf, TestingT.Fatalf, etc.),
+// just like a test.
+// If AfterPackage fails, the reporting behavior depends on if RunAsTest or Run was called.
 //
-// If RunAsTest was called, the panic will be reported as the top-level bootstrap test for the package.
-// If Run was called, every test in the package will be marked as failed,
-// and the panic's message will be appended to every test's own messages or the BeforePackage panic that replaced every test.
+// If RunAsTest was called, the failure will be reported as the top-level bootstrap test for the package.
+// If Run was called, every test in the package will be marked as failed.
 //
-// When run via Run, any logging output to the provided Tester will only be visible if AfterPackage panics or the Tester is marked as failed.
-// When run via RunAsTest, the standard `go test` output rules apply.
-// Notably, if a test fails, the output is not visible via Run but is via RunAsTest.
-//
-// NOTE: Do not call TestingT.Fail, TestingT.FailNow, TestingT.Fatal, or TestingT.Fatalf in AfterPackage to report errors; always panic.
-// It will work as expected in RunAsTest mode, but not Run mode.
-// TODO parity here.
+// When run via Run, AfterPackage's result, duration and logging output are recorded in the package's TestResult.Hooks.
+// When run via RunAsTest, its logging output is logged by the top-level bootstrap test instead.
 //
 // The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
 //
 //	var _ = testy.AfterPackage(func(){})
 func AfterPackage(f Tester) any {
-	pkg := getCallerPackage()
-	pkgTests := getPackageTests(pkg)
-
-	if pkgTests.AfterPackage != nil {
-		panic(fmt.Sprintf("package %s already has an AfterPackage", pkg))
-	}
+	return must(instance.RegisterPackageHook(getCallerPackage(), HookAfterPackage, f))
+}
 
-	pkgTests.AfterPackage = f
-	return nil
+// AfterPackage is like the package-level AfterPackage, but registers f with s.
+func (s *Suite) AfterPackage(f Tester) any {
+	return must(s.RegisterPackageHook(getCallerPackage(), HookAfterPackage, f))
 }
 
 // BeforeTest registers a function to be run before every top level registered test in the given package is run.
-// It is not run before subtests created by `t.Run`.
+// It is not run before subtests created by `t.Run`; use BeforeEach for those.
 // A package may only have one BeforeTest function.
 //
-// If BeforeTest panics, the specific registered test that was about to be invoked will be marked as failed with the panic's message.
+// BeforeTest fails if it panics or marks the provided TestingT as failed (with TestingT.Errorf, TestingT.Fatalf, etc.),
+// just like a test.
+// If BeforeTest fails, the specific registered test that was about to be invoked will not be run
+// and will be marked as failed.
+// If BeforeTest calls TestingT.Skip (or a similar method), the test is skipped instead.
 // AfterTest will still be run.
 //
-// When run via Run, any logging output to the provided Tester will only be visible if BeforeTest panics or the Tester is marked as failed.
+// When run via Run, BeforeTest's result, duration and logging output are recorded in the test's TestResult.Hooks.
 // When run via RunAsTest, the standard `go test` output rules apply.
-// Notably, if a test fails, the output is not visible via Run but is via RunAsTest.
-//
-// NOTE: Do not call TestingT.Fail, TestingT.FailNow, TestingT.Fatal, or TestingT.Fatalf in BeforeTest to report errors; always panic.
-// It will work as expected in RunAsTest mode, but not Run mode.
-// TODO parity here.
 //
 // The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
 //
 //	var _ = testy.BeforeTest(func(){})
 func BeforeTest(f Tester) any {
-	pkg := getCallerPackage()
-	pkgTests := getPackageTests(pkg)
-
-	if pkgTests.BeforeTest != nil {
-		panic(fmt.Sprintf("package %s already has a BeforeTest", pkg))
-	}
+	return must(instance.RegisterPackageHook(getCallerPackage(), HookBeforeTest, f))
+}
 
-	pkgTests.BeforeTest = f
-	return nil
+// BeforeTest is like the package-level BeforeTest, but registers f with s.
+func (s *Suite) BeforeTest(f Tester) any {
+	return must(s.RegisterPackageHook(getCallerPackage(), HookBeforeTest, f))
 }
 
 // AfterTest registers a function to be run once after every top level registered test in the given package has finished.
-// It is not run after subtests created by `t.Run`.
+// It is not run after subtests created by `t.Run`; use AfterEach for those.
 // A package may only have one AfterTest function.
 //
-// If AfterTest panics, the specific test that was just run will be marked as failed,
-// and the panic's message will be appended to the test's own messages.
+// AfterTest fails if it panics or marks the provided TestingT as failed (with TestingT.Errorf, TestingT.Fatalf, etc.),
+// just like a test.
+// If AfterTest fails, the specific test that was just run will be marked as failed.
 // Any subtests of the test will not be modified.
 //
-// When run via Run, any logging output to the provided Tester will only be visible if AfterTest panics or the Tester is marked as failed.
+// When run via Run, AfterTest's result, duration and logging output are recorded in the test's TestResult.Hooks.
 // When run via RunAsTest, the standard `go test` output rules apply.
-// Notably, if a test fails, the output is not visible via Run but is via RunAsTest.
-//
-// NOTE: Do not call TestingT.Fail, TestingT.FailNow, TestingT.Fatal, or TestingT.Fatalf in AfterTest to report errors; always panic.
-// It will work as expected in RunAsTest mode, but not Run mode.
-// TODO parity here.
 //
 // The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
 //
 //	var _ = testy.AfterTest(func(){})
 func AfterTest(f Tester) any {
-	pkg := getCallerPackage()
-	pkgTests := getPackageTests(pkg)
+	return must(instance.RegisterPackageHook(getCallerPackage(), HookAfterTest, f))
+}
+
+// AfterTest is like the package-level AfterTest, but registers f with s.
+func (s *Suite) AfterTest(f Tester) any {
+	return must(s.RegisterPackageHook(getCallerPackage(), HookAfterTest, f))
+}
+
+// BeforeEach registers a function to be run before every subtest created by `t.Run` or TestEach in the given package,
+// at any depth. It is not run before the top level registered tests; use BeforeTest for those.
+// A package may only have one BeforeEach function.
+//
+// BeforeEach is given the subtest's TestingT, so it has the subtest's name, and anything it registers with
+// TestingT.Cleanup is run once AfterEach has returned.
+// BeforeEach fails if it panics or marks the provided TestingT as failed (with TestingT.Errorf, TestingT.Fatalf, etc.),
+// just like a test.
+// If BeforeEach fails, the subtest that was about to be invoked will not be run and will be marked as failed.
+// If BeforeEach calls TestingT.Skip (or a similar method), the subtest is skipped instead.
+// AfterEach will still be run.
+//
+// When run via Run, BeforeEach's result, duration and logging output are recorded in the subtest's TestResult.Hooks.
+// When run via RunAsTest, the standard `go test` output rules apply.
+//
+// The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
+//
+//	var _ = testy.BeforeEach(func(){})
+func BeforeEach(f Tester) any {
+	return must(instance.RegisterPackageHook(getCallerPackage(), HookBeforeEach, f))
+}
+
+// BeforeEach is like the package-level BeforeEach, but registers f with s.
+func (s *Suite) BeforeEach(f Tester) any {
+	return must(s.RegisterPackageHook(getCallerPackage(), HookBeforeEach, f))
+}
+
+// AfterEach registers a function to be run after every subtest created by `t.Run` or TestEach in the given package
+// has finished, at any depth. It is not run after the top level registered tests; use AfterTest for those.
+// A package may only have one AfterEach function.
+//
+// AfterEach fails if it panics or marks the provided TestingT as failed (with TestingT.Errorf, TestingT.Fatalf, etc.),
+// just like a test.
+// If AfterEach fails, the subtest that was just run will be marked as failed.
+//
+// When run via Run, AfterEach's result, duration and logging output are recorded in the subtest's TestResult.Hooks.
+// When run via RunAsTest, the standard `go test` output rules apply.
+//
+// The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
+//
+//	var _ = testy.AfterEach(func(){})
+func AfterEach(f Tester) any {
+	return must(instance.RegisterPackageHook(getCallerPackage(), HookAfterEach, f))
+}
+
+// AfterEach is like the package-level AfterEach, but registers f with s.
+func (s *Suite) AfterEach(f Tester) any {
+	return must(s.RegisterPackageHook(getCallerPackage(), HookAfterEach, f))
+}
 
-	if pkgTests.AfterTest != nil {
-		panic(fmt.Sprintf("package %s already has an AfterTest", pkg))
+// BeforeSuite registers a function to be run once before any tests in any package are run.
+// Only one BeforeSuite function may be registered; put it in a package that every test package imports.
+// When using RunAsTest, it is run once per test binary, which is usually once per package.
+//
+// BeforeSuite fails if it panics or marks the provided TestingT as failed (with TestingT.Errorf, TestingT.Fatalf, etc.),
+// just like a test.
+// If BeforeSuite fails, no packages will be run, including their Before/After functions, and AfterSuite will still be run.
+// If BeforeSuite calls TestingT.Skip (or a similar method), every test is skipped instead.
+//
+// If RunAsTest was called, the failure will be reported as the top-level bootstrap test.
+// If Run was called, every registered test will be marked as failed.
+//
+// When run via Run, BeforeSuite's result, duration and logging output are recorded in the top level TestResult.Hooks.
+// When run via RunAsTest, its logging output is logged by the top-level bootstrap test instead.
+//
+// The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
+//
+//	var _ = testy.BeforeSuite(func(){})
+func BeforeSuite(f Tester) any {
+	return instance.BeforeSuite(f)
+}
+
+// BeforeSuite is like the package-level BeforeSuite, but registers f with s.
+func (s *Suite) BeforeSuite(f Tester) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.beforeSuite != nil {
+		panic("there is already a BeforeSuite")
+	}
+
+	s.beforeSuite = f
+	return nil
+}
+
+// AfterSuite registers a function to be run once after all tests in all packages have finished.
+// Only one AfterSuite function may be registered; put it in a package that every test package imports.
+// When using RunAsTest, it is run once per test binary, which is usually once per package.
+//
+// AfterSuite fails if it panics or marks the provided TestingT as failed (with TestingT.Errorf, TestingT.Fatalf, etc.),
+// just like a test.
+//
+// If RunAsTest was called, the failure will be reported as the top-level bootstrap test.
+// If Run was called, every test will be marked as failed.
+//
+// When run via Run, AfterSuite's result, duration and logging output are recorded in the top level TestResult.Hooks.
+// When run via RunAsTest, its logging output is logged by the top-level bootstrap test instead.
+//
+// The return value may be discarded (and is always nil); it is provided to simplify writing test code, like so:
+//
+//	var _ = testy.AfterSuite(func(){})
+func AfterSuite(f Tester) any {
+	return instance.AfterSuite(f)
+}
+
+// AfterSuite is like the package-level AfterSuite, but registers f with s.
+func (s *Suite) AfterSuite(f Tester) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.afterSuite != nil {
+		panic("there is already an AfterSuite")
 	}
 
-	pkgTests.AfterTest = f
+	s.afterSuite = f
 	return nil
 }
 
@@ -198,18 +474,90 @@ func packageAndFuncNameToPackage(full string) string {
 	return full[:i+j]
 }
 
-// getPackageTests ensures that a testPkg instance exists for the provided package and returns it
-func getPackageTests(pkg string) *testPkg {
-	if instance.tests == nil {
-		instance.tests = make(orderedmap.OrderedMap[string, *testPkg])
+// Hook identifies one of the Before/After functions a package may have, for use with RegisterPackageHook.
+type Hook string
+
+const (
+	// HookBeforePackage is the function registered by BeforePackage.
+	HookBeforePackage Hook = "BeforePackage"
+	// HookAfterPackage is the function registered by AfterPackage.
+	HookAfterPackage Hook = "AfterPackage"
+	// HookBeforeTest is the function registered by BeforeTest.
+	HookBeforeTest Hook = "BeforeTest"
+	// HookAfterTest is the function registered by AfterTest.
+	HookAfterTest Hook = "AfterTest"
+	// HookBeforeEach is the function registered by BeforeEach.
+	HookBeforeEach Hook = "BeforeEach"
+	// HookAfterEach is the function registered by AfterEach.
+	HookAfterEach Hook = "AfterEach"
+)
+
+// packageHooks gives access to each of a package's Before/After functions.
+var packageHooks = map[Hook]func(*testPkg) *Tester{
+	HookBeforePackage: func(p *testPkg) *Tester { return &p.BeforePackage },
+	HookAfterPackage:  func(p *testPkg) *Tester { return &p.AfterPackage },
+	HookBeforeTest:    func(p *testPkg) *Tester { return &p.BeforeTest },
+	HookAfterTest:     func(p *testPkg) *Tester { return &p.AfterTest },
+	HookBeforeEach:    func(p *testPkg) *Tester { return &p.BeforeEach },
+	HookAfterEach:     func(p *testPkg) *Tester { return &p.AfterEach },
+}
+
+// RegisterPackageHook registers f as the given Before/After function of the package pkg, which need not be a Go package.
+// It behaves the same as the function named by hook, such as BeforePackage,
+// except that it may be called at any time and returns an error instead of panicking if f cannot be registered.
+// Runs that have already started are not affected.
+func RegisterPackageHook(pkg string, hook Hook, f Tester) error {
+	return instance.RegisterPackageHook(pkg, hook, f)
+}
+
+// RegisterPackageHook is like the package-level RegisterPackageHook, but registers f with s.
+func (s *Suite) RegisterPackageHook(pkg string, hook Hook, f Tester) error {
+	field, ok := packageHooks[hook]
+	if !ok {
+		return fmt.Errorf("unknown hook %q", hook)
+	}
+	if pkg == "" {
+		return fmt.Errorf("%s has no package", hook)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := field(s.getPackageTests(pkg))
+	if *existing != nil {
+		article := "a"
+		if strings.HasPrefix(string(hook), "After") {
+			article = "an"
+		}
+		return fmt.Errorf("package %s already has %s %s", pkg, article, hook)
+	}
+
+	*existing = f
+	return nil
+}
+
+// must panics if err is not nil, for the funcs that are called during package initialization.
+// It always returns nil so that they can be used like `var _ = testy.Test(...)`.
+func must(err error) any {
+	if err != nil {
+		panic(err.Error())
+	}
+	return nil
+}
+
+// getPackageTests ensures that a testPkg instance exists for the provided package and returns it.
+// s.mu must be held for writing.
+func (s *Suite) getPackageTests(pkg string) *testPkg {
+	if s.tests == nil {
+		s.tests = make(orderedmap.OrderedMap[string, *testPkg])
 	}
 
-	if instance.tests[pkg] == nil {
-		instance.tests[pkg] = &testPkg{
+	if s.tests[pkg] == nil {
+		s.tests[pkg] = &testPkg{
 			name:  pkg,
 			tests: make(orderedmap.OrderedMap[string, testCase]),
 		}
 	}
 
-	return instance.tests[pkg]
+	return s.tests[pkg]
 }
@@ -4,10 +4,11 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetCallerPackage(t *testing.T) {
-	instance = testy{}
+	instance = &Suite{}
 
 	var pkg string
 	// we have to do this in a nested func since it skips an extra caller level
@@ -31,7 +32,7 @@ func TestPackageAndFuncNameToPackage(t *testing.T) {
 }
 
 func TestTest(t *testing.T) {
-	instance = testy{}
+	instance = &Suite{}
 
 	Test("test", func(t TestingT) {})
 
@@ -49,7 +50,7 @@ func TestTest(t *testing.T) {
 }
 
 func TestBeforePackage(t *testing.T) {
-	instance = testy{}
+	instance = &Suite{}
 
 	BeforePackage(func(t TestingT) {})
 
@@ -64,7 +65,7 @@ func TestBeforePackage(t *testing.T) {
 }
 
 func TestAfterPackage(t *testing.T) {
-	instance = testy{}
+	instance = &Suite{}
 
 	AfterPackage(func(t TestingT) {})
 
@@ -79,7 +80,7 @@ func TestAfterPackage(t *testing.T) {
 }
 
 func TestBeforeTest(t *testing.T) {
-	instance = testy{}
+	instance = &Suite{}
 
 	BeforeTest(func(t TestingT) {})
 
@@ -94,7 +95,7 @@ func TestBeforeTest(t *testing.T) {
 }
 
 func TestAfterTest(t *testing.T) {
-	instance = testy{}
+	instance = &Suite{}
 
 	AfterTest(func(t TestingT) {})
 
@@ -107,3 +108,179 @@ func TestAfterTest(t *testing.T) {
 		AfterTest(func(t TestingT) {})
 	})
 }
+
+func TestBeforeEach(t *testing.T) {
+	instance = &Suite{}
+
+	BeforeEach(func(t TestingT) {})
+
+	assert.Contains(t, instance.tests, "github.com/gametimesf/testy")
+	pkgTests := instance.tests["github.com/gametimesf/testy"]
+	// funcs can only be compared to nil, not each other, so even using a known func doesn't help
+	assert.NotNil(t, pkgTests.BeforeEach)
+
+	assert.Panics(t, func() {
+		BeforeEach(func(t TestingT) {})
+	})
+}
+
+func TestAfterEach(t *testing.T) {
+	instance = &Suite{}
+
+	AfterEach(func(t TestingT) {})
+
+	assert.Contains(t, instance.tests, "github.com/gametimesf/testy")
+	pkgTests := instance.tests["github.com/gametimesf/testy"]
+	// funcs can only be compared to nil, not each other, so even using a known func doesn't help
+	assert.NotNil(t, pkgTests.AfterEach)
+
+	assert.Panics(t, func() {
+		AfterEach(func(t TestingT) {})
+	})
+}
+
+func TestBeforeSuite(t *testing.T) {
+	instance = &Suite{}
+
+	BeforeSuite(func(t TestingT) {})
+
+	assert.NotNil(t, instance.beforeSuite)
+
+	assert.Panics(t, func() {
+		BeforeSuite(func(t TestingT) {})
+	})
+}
+
+func TestAfterSuite(t *testing.T) {
+	instance = &Suite{}
+
+	AfterSuite(func(t TestingT) {})
+
+	assert.NotNil(t, instance.afterSuite)
+
+	assert.Panics(t, func() {
+		AfterSuite(func(t TestingT) {})
+	})
+}
+
+func TestTestMetadata(t *testing.T) {
+	instance = &Suite{}
+
+	Test("test", func(t TestingT) {},
+		Tags("smoke"),
+		Tags("payments", "slow"),
+		Owner("checkout"),
+		Description("buys a ticket"),
+		Runbook("https://example.com/runbook"),
+	)
+	Test("no metadata", func(t TestingT) {})
+
+	pkgTests := instance.tests["github.com/gametimesf/testy"]
+	tc := pkgTests.tests["test"]
+	assert.Equal(t, Metadata{
+		Tags:        []string{"smoke", "payments", "slow"},
+		Owner:       "checkout",
+		Description: "buys a ticket",
+		Runbook:     "https://example.com/runbook",
+	}, tc.metadata)
+	assert.True(t, tc.metadata.HasTag("payments"))
+	assert.False(t, tc.metadata.HasTag("flaky"))
+	assert.Equal(t, &tc.metadata, tc.resultMetadata())
+
+	assert.Nil(t, pkgTests.tests["no_metadata"].resultMetadata())
+}
+
+func TestSuite(t *testing.T) {
+	instance = &Suite{}
+
+	var public, partner Suite
+	public.Test("test", func(t TestingT) {})
+	public.BeforePackage(func(t TestingT) {})
+	partner.Test("test", func(t TestingT) {})
+	partner.BeforeSuite(func(t TestingT) {})
+
+	assert.Empty(t, instance.tests, "the default suite has nothing registered")
+	assert.Nil(t, public.beforeSuite)
+	assert.NotNil(t, partner.beforeSuite)
+
+	require.Contains(t, public.tests, "github.com/gametimesf/testy")
+	assert.Contains(t, public.tests["github.com/gametimesf/testy"].tests, "test")
+	assert.NotNil(t, public.tests["github.com/gametimesf/testy"].BeforePackage)
+
+	require.Contains(t, partner.tests, "github.com/gametimesf/testy")
+	assert.Contains(t, partner.tests["github.com/gametimesf/testy"].tests, "test")
+	assert.Nil(t, partner.tests["github.com/gametimesf/testy"].BeforePackage)
+
+	assert.Panics(t, func() {
+		public.BeforePackage(func(t TestingT) {})
+	})
+	assert.NotPanics(t, func() {
+		partner.BeforePackage(func(t TestingT) {})
+	})
+}
+
+func TestRegisterTest(t *testing.T) {
+	instance = &Suite{}
+
+	require.NoError(t, RegisterTest("api/pets", "list pets", func(t TestingT) {}, Tags("generated")))
+	require.Contains(t, instance.tests, "api/pets")
+	pkgTests := instance.tests["api/pets"]
+	require.Contains(t, pkgTests.tests, "list_pets")
+	assert.Equal(t, "api/pets", pkgTests.tests["list_pets"].Package)
+	assert.Equal(t, []string{"generated"}, pkgTests.tests["list_pets"].metadata.Tags)
+
+	assert.EqualError(t, RegisterTest("api/pets", "list pets", func(t TestingT) {}),
+		"test list_pets already exists in package api/pets")
+	assert.EqualError(t, RegisterTest("api/pets", "nil", nil), "test nil has nil test function")
+	assert.EqualError(t, RegisterTest("", "test", func(t TestingT) {}), "test test has no package")
+
+	assert.False(t, UnregisterTest("api/pets", "get pet"))
+	assert.False(t, UnregisterTest("api/stores", "list pets"))
+	assert.True(t, UnregisterTest("api/pets", "list pets"))
+	assert.NotContains(t, pkgTests.tests, "list_pets")
+	assert.NoError(t, RegisterTest("api/pets", "list pets", func(t TestingT) {}), "can be registered again")
+
+	assert.True(t, UnregisterPackage("api/pets"))
+	assert.NotContains(t, instance.tests, "api/pets")
+	assert.False(t, UnregisterPackage("api/pets"))
+}
+
+func TestRegisterPackageHook(t *testing.T) {
+	instance = &Suite{}
+
+	require.NoError(t, RegisterPackageHook("api/pets", HookBeforePackage, func(t TestingT) {}))
+	require.NoError(t, RegisterPackageHook("api/pets", HookAfterEach, func(t TestingT) {}))
+	require.Contains(t, instance.tests, "api/pets")
+	assert.NotNil(t, instance.tests["api/pets"].BeforePackage)
+	assert.NotNil(t, instance.tests["api/pets"].AfterEach)
+
+	assert.EqualError(t, RegisterPackageHook("api/pets", HookBeforePackage, func(t TestingT) {}),
+		"package api/pets already has a BeforePackage")
+	assert.EqualError(t, RegisterPackageHook("api/pets", HookAfterEach, func(t TestingT) {}),
+		"package api/pets already has an AfterEach")
+	assert.EqualError(t, RegisterPackageHook("api/pets", "BeforeAll", func(t TestingT) {}), `unknown hook "BeforeAll"`)
+	assert.EqualError(t, RegisterPackageHook("", HookAfterTest, func(t TestingT) {}), "AfterTest has no package")
+}
+
+func TestRetries(t *testing.T) {
+	instance = &Suite{}
+
+	Test("a", func(t TestingT) {}, Retries(5))
+	Test("b", func(t TestingT) {})
+	assert.Panics(t, func() {
+		Test("c", func(t TestingT) {})
+		PackageRetries(2)
+		PackageRetries(3)
+	})
+
+	pkgTests := instance.tests["github.com/gametimesf/testy"]
+	assert.Equal(t, 2, pkgTests.retries)
+
+	cfg, err := RunOptions{Retries: 1}.parse()
+	require.NoError(t, err)
+	assert.Equal(t, 5, cfg.testRetries(pkgTests, pkgTests.tests["a"]))
+	assert.Equal(t, 2, cfg.testRetries(pkgTests, pkgTests.tests["b"]))
+
+	pkgTests.retries = 0
+	assert.Equal(t, 1, cfg.testRetries(pkgTests, pkgTests.tests["b"]))
+}
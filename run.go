@@ -1,8 +1,13 @@
 package testy
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"math/rand"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -18,312 +23,623 @@ import (
 // Individual tests in a package may still be run using the standard -run test flag.
 // See `go help testflag` for more information.
 //
-// TODO: shuffle test execution order (see -shuffle in `go help testflag`)
+// The execution order of packages and tests is shuffled according to the -shuffle test flag.
+// If it is "on", RunAsTest picks its own seed, since the one that go test prints is not available to it,
+// and logs it as "testy: -test.shuffle N". Only that seed replays the order of RunAsTest's packages and tests
+// when passed to -shuffle; the seed printed by go test itself only orders the test functions of the package.
 func RunAsTest(t *testing.T) {
 	t.Helper()
-	instance.tests.Iterate(func(pkg string, pkgTests *testPkg) bool {
-		// we have to hold onto any panics here to be able to run AfterPackage
-		var beforePkgErr any
+	instance.RunAsTest(t)
+}
+
+// RunAsTest is like the package-level RunAsTest, but runs the tests registered with s.
+func (s *Suite) RunAsTest(t *testing.T) {
+	t.Helper()
+
+	var cfg runConfig
+	if f := flag.Lookup("test.shuffle"); f != nil {
+		var err error
+		cfg.shuffle, cfg.seed, err = parseShuffle(f.Value.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Value.String() == "on" {
+			// labelled so that it is not mistaken for the seed that go test prints itself, which is different
+			t.Logf("testy: -test.shuffle %d", cfg.seed)
+		}
+	}
+
+	// the suite's Before/After functions get our own t for the same reason as the package's ones below
+	beforeSuite, afterSuite := s.suiteHooks()
+	suiteHelperT := newHelperT(context.Background(), "", "")
+	// run AfterSuite even if a package fails and stops the test
+	defer func() {
+		hook := runHook(suiteHelperT, "AfterSuite", afterHook(afterSuite, suiteHelperT))
+		logMsgs(t, hook)
+		if hook.Result == ResultFailed {
+			t.Errorf("AfterSuite failed")
+		}
+	}()
+
+	if beforeSuite != nil {
+		hook := runHook(suiteHelperT, "BeforeSuite", beforeSuite)
+		logMsgs(t, hook)
+		switch hook.Result {
+		case ResultFailed:
+			t.Fatalf("BeforeSuite failed")
+		case ResultSkipped:
+			t.SkipNow()
+		}
+	}
+
+	// strip our own name from the names of the tests, so that they are the same as when using Run
+	prefix := t.Name() + "/"
+	for _, pp := range s.planRun(cfg) {
+		pkgTests := pp.pkg
+
+		// the package's Before/After functions get our own t rather than t itself,
+		// so that a failure in BeforePackage can stop the package's tests without stopping AfterPackage,
+		// the same as when using Run
+		pkgHelperT := newHelperT(context.Background(), pkgTests.name, "")
+		var failures []string
+
+		var beforePkgResult Result
 		if pkgTests.BeforePackage != nil {
-			func() {
-				defer func() {
-					if beforePkgErr = recover(); beforePkgErr != nil {
-						beforePkgErr = fmt.Sprintf("before package: %v\n\n%s", beforePkgErr, debug.Stack())
-					}
-				}()
-				pkgTests.BeforePackage(tWrapper{t: t})
-			}()
+			hook := runHook(pkgHelperT, "BeforePackage", pkgTests.BeforePackage)
+			logMsgs(t, hook)
+			beforePkgResult = hook.Result
+			if beforePkgResult == ResultFailed {
+				failures = append(failures, hook.Name)
+			}
 		}
 
-		// only run the tests if any BeforePackage didn't panic
-		if beforePkgErr == nil {
-			pkgTests.tests.Iterate(func(name string, test testCase) bool {
+		// only run the tests if BeforePackage didn't fail
+		if beforePkgResult != ResultFailed {
+			for _, test := range pp.tests {
 				t.Run(test.Name, func(tt *testing.T) {
 					tt.Helper()
 
-					// if we have an AfterTest, defer it so it always runs even if BeforeTest or the test itself panic
+					if beforePkgResult == ResultSkipped {
+						tt.SkipNow()
+					}
+
+					// if we have an AfterTest, defer it so it always runs even if BeforeTest or the test itself fail or panic
 					if pkgTests.AfterTest != nil {
-						defer pkgTests.AfterTest(tWrapper{t: tt})
+						defer pkgTests.AfterTest(tWrapper{t: tt, prefix: prefix, pkgTests: pkgTests})
 					}
 
-					// if we have a BeforeTest, just run it directly; panics will sort themselves out
+					// if we have a BeforeTest, just run it directly; FailNow, SkipNow and panics will sort themselves out
 					if pkgTests.BeforeTest != nil {
-						pkgTests.BeforeTest(tWrapper{t: tt})
+						pkgTests.BeforeTest(tWrapper{t: tt, prefix: prefix, pkgTests: pkgTests})
+						if tt.Failed() {
+							return
+						}
 					}
 
-					test.tester(tWrapper{t: tt})
+					test.tester(tWrapper{t: tt, prefix: prefix, pkgTests: pkgTests})
 				})
-				return true
-			})
+			}
 		}
 
-		// and we have to hold onto any panics here to give priority to any panics from BeforePackage
-		var afterPkgErr any
-		if pkgTests.AfterPackage != nil {
-			func() {
-				defer func() {
-					if afterPkgErr = recover(); afterPkgErr != nil {
-						afterPkgErr = fmt.Sprintf("after package: %v\n\n%s", afterPkgErr, debug.Stack())
-					}
-				}()
-				pkgTests.AfterPackage(tWrapper{t: t})
-			}()
+		hook := runHook(pkgHelperT, "AfterPackage", afterHook(pkgTests.AfterPackage, pkgHelperT))
+		logMsgs(t, hook)
+		if hook.Result == ResultFailed {
+			failures = append(failures, hook.Name)
 		}
 
-		if beforePkgErr != nil {
-			panic(beforePkgErr)
-		}
-		if afterPkgErr != nil {
-			panic(afterPkgErr)
+		// carry on with the other packages, the same as when using Run
+		if len(failures) > 0 {
+			t.Errorf("%s failed for package %s", strings.Join(failures, " and "), pkgTests.name)
 		}
+	}
+}
 
-		return true
-	})
+// logMsgs logs the messages of a Before/After function to the real t.
+func logMsgs(tt *testing.T, hook TestResult) {
+	tt.Helper()
+	for _, m := range hook.Msgs {
+		tt.Logf("%s: %s", hook.Name, m.Msg)
+	}
 }
 
 // Run runs all registered tests and returns result information about them.
+func Run() TestResult {
+	return instance.Run()
+}
+
+// Run is like the package-level Run, but runs the tests registered with s.
+func (s *Suite) Run() TestResult {
+	// the zero value options are always valid
+	results, _ := s.RunContext(context.Background(), RunOptions{})
+	return results
+}
+
+// RunWithOptions runs the registered tests selected by opts and returns result information about them.
+// Tests that are not selected are omitted from the results entirely,
+// and packages that have no selected tests are skipped without running any of their Before/After functions.
 //
-// TODO: ability to filter for specific packages and tests
-//
-// TODO: shuffle test execution order (see -shuffle in `go help testflag`)
+// An error is returned if opts is invalid, in which case no tests are run.
 //
-// TODO: channel for results to support progressive result loading?
-func Run() TestResult {
+// To receive results while the tests are still running, use Stream instead.
+func RunWithOptions(opts RunOptions) (TestResult, error) {
+	return instance.RunWithOptions(opts)
+}
+
+// RunWithOptions is like the package-level RunWithOptions, but runs the tests registered with s.
+func (s *Suite) RunWithOptions(opts RunOptions) (TestResult, error) {
+	return s.RunContext(context.Background(), opts)
+}
+
+// RunContext is like RunWithOptions, but stops running tests once ctx is done.
+// Tests that are running when ctx is done are not interrupted, but can observe it via TestingT.Context.
+// Tests that had not started yet are marked as ResultCancelled.
+func RunContext(ctx context.Context, opts RunOptions) (TestResult, error) {
+	return instance.RunContext(ctx, opts)
+}
+
+// RunContext is like the package-level RunContext, but runs the tests registered with s.
+func (s *Suite) RunContext(ctx context.Context, opts RunOptions) (TestResult, error) {
+	events, err := s.StreamContext(ctx, opts)
+	if err != nil {
+		return TestResult{}, err
+	}
+
+	var results TestResult
+	for ev := range events {
+		if ev.Kind == EventSuiteFinished {
+			results = *ev.Result
+		}
+	}
+	return results, nil
+}
+
+// runSuite runs the tests selected by cfg, sending events for its progress to cfg.events.
+func (s *Suite) runSuite(ctx context.Context, cfg runConfig) {
 	start := time.Now()
 	results := TestResult{
 		Name:    "Test Suite",
 		Started: start,
+		Profile: cfg.profile,
 	}
-	anyFailures := false
-
-	// TODO run packages in parallel like go test does
-	instance.tests.Iterate(func(pkg string, pkgTests *testPkg) bool {
-		pkgStart := time.Now()
-		results.Subtests = append(results.Subtests, TestResult{
-			Package: pkg,
-			Name:    "Package",
-			Started: pkgStart,
-		})
-		pkgResults := &results.Subtests[len(results.Subtests)-1]
 
-		pkgHelperT := &t{}
-		pkgAnyFailures := false
+	if cfg.shuffle {
+		results.Shuffle = strconv.FormatInt(cfg.seed, 10)
+	}
 
-		// we have to hold onto any panics here to be able to run AfterPackage
-		var beforePkgErr any
-		if pkgTests.BeforePackage != nil {
-			func() {
+	plan := s.planRun(cfg)
+	results.Subtests = make([]TestResult, len(plan))
+
+	beforeSuite, afterSuite := s.suiteHooks()
+	if cfg.captureLog {
+		logCapture.start()
+		defer logCapture.stop()
+	}
+
+	suiteHelperT := newHelperT(ctx, "", "")
+	suiteHelperT.captureLog = cfg.captureLog
+	r := ResultPassed
+
+	var beforeSuiteResult Result
+	if beforeSuite != nil {
+		hook := runHook(suiteHelperT, "BeforeSuite", beforeSuite)
+		results.Hooks = append(results.Hooks, hook)
+		beforeSuiteResult = hook.Result
+	}
+
+	if beforeSuiteResult == ResultFailed || beforeSuiteResult == ResultSkipped {
+		// BeforeSuite failed or skipped, so simply mark every test the same way
+		// its messages are only in its hook result, rather than repeated for every test
+		level := LevelError
+		if beforeSuiteResult == ResultSkipped {
+			level = LevelInfo
+		}
+		for i, pp := range plan {
+			results.Subtests[i] = notRunPackage(cfg, pp, beforeSuiteResult, Msg{
+				Msg:   fmt.Sprintf("not run because BeforeSuite %s", beforeSuiteResult),
+				Level: level,
+			})
+		}
+	} else {
+		// like go test, run up to PackageConcurrency packages at once.
+		// each package writes only to its own pre-allocated slot so the results are always in package order.
+		sem := make(chan struct{}, cfg.packageConcurrency)
+		wg := sync.WaitGroup{}
+		for i, pp := range plan {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int, pp plannedPackage) {
 				defer func() {
-					if beforePkgErr = recover(); beforePkgErr != nil {
-						beforePkgErr = fmt.Sprintf("before package: %v\n\n%s", beforePkgErr, debug.Stack())
-					}
+					<-sem
+					wg.Done()
 				}()
-				pkgTests.BeforePackage(pkgHelperT)
-			}()
-
-			if beforePkgErr != nil {
-				pkgAnyFailures = true
-				pkgResults.Msgs = []Msg{
-					{
-						Msg:   fmt.Sprintf("%v", beforePkgErr),
+				// don't start any more packages once we've been cancelled or failed fast
+				if err := cfg.stopped(ctx); err != nil {
+					results.Subtests[i] = notRunPackage(cfg, pp, ResultCancelled, Msg{
+						Msg:   fmt.Sprintf("not run: %v", err),
 						Level: LevelError,
-					},
+					})
+					return
 				}
-			}
+				results.Subtests[i] = runPackage(ctx, cfg, pp)
+			}(i, pp)
 		}
+		wg.Wait()
+	}
 
-		// we still have to iterate even if there was a BeforePackage panic to be able to fail all the tests
-		pkgTests.tests.Iterate(func(name string, test testCase) bool {
-			// only run the tests if BeforePackage didn't panic
-			if beforePkgErr == nil {
-				testHelperT := &t{}
-
-				// we have to hold onto any panics here to be able to run AfterTest
-				var beforeTestErr any
-				if pkgTests.BeforeTest != nil {
-					func() {
-						defer func() {
-							if beforeTestErr = recover(); beforeTestErr != nil {
-								beforeTestErr = fmt.Sprintf("before test: %v\n\n%s", beforeTestErr, debug.Stack())
-							}
-						}()
-						pkgTests.BeforeTest(testHelperT)
-					}()
-				}
-
-				// only run the tests if any BeforeTest didn't panic
-				if beforeTestErr == nil {
-					res := runTest(pkg, test.Name, test.tester)
-					if res.Result == ResultFailed {
-						pkgAnyFailures = true
-					}
-					pkgResults.Subtests = append(pkgResults.Subtests, res)
-				} else {
-					pkgAnyFailures = true
-					pkgResults.Subtests = append(pkgResults.Subtests, TestResult{
-						Package:  pkg,
-						Name:     name,
-						Started:  time.Now(),
-						Result:   ResultFailed,
-						Dur:      0,
-						DurHuman: "0s",
-						Msgs: append(testHelperT.msgs, Msg{
-							Msg:   fmt.Sprintf("%v", beforeTestErr),
-							Level: LevelError,
-						}),
-					})
-				}
+	hook := runHook(suiteHelperT, "AfterSuite", afterHook(afterSuite, suiteHelperT))
+	// only record AfterSuite if there is one, or if a cleanup function registered by BeforeSuite failed
+	if afterSuite != nil || hook.Result == ResultFailed {
+		results.Hooks = append(results.Hooks, hook)
+	}
 
-				if pkgTests.AfterTest != nil {
-					var afterTestErr any
-					func() {
-						defer func() {
-							if afterTestErr = recover(); afterTestErr != nil {
-								afterTestErr = fmt.Sprintf("after test: %v\n\n%s", afterTestErr, debug.Stack())
-							}
-						}()
-						pkgTests.AfterTest(testHelperT)
-					}()
-
-					if afterTestErr != nil {
-						pkgAnyFailures = true
-						// update test results marking it failed and with this panic message.
-						r := &pkgResults.Subtests[len(pkgResults.Subtests)-1]
-						r.Result = ResultFailed
-						r.Msgs = append(r.Msgs, append(testHelperT.msgs, Msg{
-							Msg:   fmt.Sprintf("%v", afterTestErr),
-							Level: LevelError,
-						})...)
-					}
-				}
-			} else {
-				pkgAnyFailures = true
-				// BeforePackage panicked, so simply mark the test as failed with its message
-				pkgResults.Subtests = append(pkgResults.Subtests, TestResult{
-					Package:  pkg,
-					Name:     name,
-					Started:  pkgStart,
-					Result:   ResultFailed,
-					Dur:      0,
-					DurHuman: "0s",
-					Msgs: append(pkgHelperT.msgs, Msg{
-						Msg:   fmt.Sprintf("%v", beforePkgErr),
-						Level: LevelError,
-					}),
-				})
+	// update test results if AfterSuite failed
+	if hook.Result == ResultFailed {
+		m := Msg{
+			Msg:   "AfterSuite failed",
+			Level: LevelError,
+		}
+		for i := range results.Subtests {
+			pkgResults := &results.Subtests[i]
+			pkgResults.Result = ResultFailed
+			for j := range pkgResults.Subtests {
+				res := &pkgResults.Subtests[j]
+				res.Result = ResultFailed
+				res.Msgs = append(res.Msgs, m)
 			}
+		}
+		r = ResultFailed
+	}
 
-			return true
+	for _, pkgResults := range results.Subtests {
+		r = worstResult(r, pkgResults.Result)
+	}
+	results.Result = r
+	dur := time.Since(start).Round(time.Millisecond)
+	results.Dur = dur
+	results.DurHuman = dur.String()
+	cfg.emit(Event{Kind: EventSuiteFinished, Result: &results})
+}
+
+// plannedPackage is a package that has at least one test selected to run.
+type plannedPackage struct {
+	pkg   *testPkg
+	tests []testCase
+}
+
+// planRun determines which packages and tests are selected by cfg, in the order they are to be run.
+func (s *Suite) planRun(cfg runConfig) []plannedPackage {
+	plan := s.selectTests(cfg)
+	if cfg.shuffle {
+		// shuffle everything up front using a single source so that the order only depends on the seed,
+		// and not on the order that concurrently run packages happen to start in
+		rng := rand.New(rand.NewSource(cfg.seed))
+		rng.Shuffle(len(plan), func(i, j int) {
+			plan[i], plan[j] = plan[j], plan[i]
 		})
+		for _, pp := range plan {
+			rng.Shuffle(len(pp.tests), func(i, j int) {
+				pp.tests[i], pp.tests[j] = pp.tests[j], pp.tests[i]
+			})
+		}
+	}
+	return plan
+}
 
-		var afterPkgErr any
-		if pkgTests.AfterPackage != nil {
-			func() {
-				defer func() {
-					if afterPkgErr = recover(); afterPkgErr != nil {
-						afterPkgErr = fmt.Sprintf("after package: %v\n\n%s", afterPkgErr, debug.Stack())
-					}
-				}()
-				pkgTests.AfterPackage(pkgHelperT)
-			}()
+// suiteHooks returns the suite's BeforeSuite and AfterSuite functions.
+func (s *Suite) suiteHooks() (before, after Tester) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.beforeSuite, s.afterSuite
+}
+
+// selectTests finds the packages and tests selected by cfg, in lexicographical order.
+// Each package is copied so that the run is not affected by anything registered or unregistered once it has started.
+func (s *Suite) selectTests(cfg runConfig) []plannedPackage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var plan []plannedPackage
+	s.tests.Iterate(func(pkg string, pkgTests *testPkg) bool {
+		if !cfg.selectsPackage(pkg) {
+			return true
 		}
 
-		// update test results if AfterPackage panicked
-		if afterPkgErr != nil {
-			pkgAnyFailures = true
-			m := Msg{
-				Msg:   fmt.Sprintf("%v", afterPkgErr),
-				Level: LevelError,
-			}
-			for i := range pkgResults.Subtests {
-				r := &pkgResults.Subtests[i]
-				r.Result = ResultFailed
-				r.Msgs = append(r.Msgs, append(pkgHelperT.msgs, m)...)
+		var selected []testCase
+		pkgTests.tests.Iterate(func(name string, test testCase) bool {
+			if ok, _ := cfg.run.matches(name); ok && cfg.selectsMetadata(test.metadata) {
+				selected = append(selected, test)
 			}
-			pkgResults.Msgs = append(pkgResults.Msgs, m)
+			return true
+		})
+		if len(selected) > 0 {
+			pkgCopy := *pkgTests
+			pkgCopy.tests = nil
+			plan = append(plan, plannedPackage{pkg: &pkgCopy, tests: selected})
 		}
+		return true
+	})
+	return plan
+}
 
-		r := ResultPassed
-		if pkgAnyFailures {
-			r = ResultFailed
-			anyFailures = true
-		}
-		pkgResults.Result = r
-		dur := time.Since(pkgStart).Round(time.Millisecond)
-		pkgResults.Dur = dur
-		pkgResults.DurHuman = dur.String()
+// notRunPackage marks every selected test in a package with the result r and msg without running anything.
+func notRunPackage(cfg runConfig, pp plannedPackage, r Result, msg Msg) TestResult {
+	pkg := pp.pkg.name
+	pkgResults := TestResult{
+		Package:  pkg,
+		Name:     "Package",
+		Started:  time.Now(),
+		Result:   r,
+		DurHuman: "0s",
+	}
+	cfg.emit(Event{Kind: EventPackageStarted, Package: pkg})
+	for _, test := range pp.tests {
+		res := notRunResult(pkg, test.Name, r, msg)
+		res.Metadata = test.resultMetadata()
+		pkgResults.Subtests = append(pkgResults.Subtests, res)
+		cfg.emit(Event{Kind: EventTestFinished, Package: pkg, Name: test.Name, Result: &res})
+	}
+	cfg.emit(Event{Kind: EventPackageFinished, Package: pkg, Result: &pkgResults})
+	return pkgResults
+}
 
-		return true
+// cancelledResult is the result for a test that was never started because the run was cancelled.
+func cancelledResult(pkg, name string, err error) TestResult {
+	return notRunResult(pkg, name, ResultCancelled, Msg{
+		Msg:   fmt.Sprintf("not run: %v", err),
+		Level: LevelError,
 	})
+}
 
-	r := ResultPassed
-	if anyFailures {
-		r = ResultFailed
+// notRunResult is the result for a test that was never started, with msg explaining why.
+func notRunResult(pkg, name string, r Result, msg Msg) TestResult {
+	return TestResult{
+		Package:  pkg,
+		Name:     name,
+		Started:  time.Now(),
+		Result:   r,
+		DurHuman: "0s",
+		Msgs:     []Msg{msg},
 	}
-	results.Result = r
-	dur := time.Since(start).Round(time.Millisecond)
-	results.Dur = dur
-	results.DurHuman = dur.String()
-	return results
 }
 
-func runTest(pkg, baseName string, tester Tester) TestResult {
-	result := TestResult{
+// runPackage runs the selected tests of a single package, along with its Before/After functions.
+func runPackage(ctx context.Context, cfg runConfig, pp plannedPackage) TestResult {
+	pkg := pp.pkg.name
+	pkgTests := pp.pkg
+	pkgStart := time.Now()
+	pkgResults := TestResult{
 		Package: pkg,
-		Name:    baseName,
+		Name:    "Package",
+		Started: pkgStart,
+	}
+	cfg.emit(Event{Kind: EventPackageStarted, Package: pkg})
+
+	pkgHelperT := newHelperT(ctx, pkg, "")
+	pkgHelperT.captureLog = cfg.captureLog
+	pkgResult := ResultPassed
+
+	var beforePkgResult Result
+	if pkgTests.BeforePackage != nil {
+		hook := runHook(pkgHelperT, "BeforePackage", pkgTests.BeforePackage)
+		pkgResults.Hooks = append(pkgResults.Hooks, hook)
+		beforePkgResult = hook.Result
+		pkgResult = worstResult(pkgResult, hook.Result)
+	}
+
+	if beforePkgResult != ResultFailed && beforePkgResult != ResultSkipped {
+		// top level tests are run as subtests of a root t so that they can be parallel with each other, like go test
+		root := newRootT(ctx, pkgTests, &cfg)
+		for _, test := range pp.tests {
+			// stop starting tests once we've been cancelled or failed fast, but still finish the package normally
+			if err := cfg.stopped(ctx); err != nil {
+				root.cancelChild(test.Name, err, test.resultMetadata())
+				continue
+			}
+			tester := testWithHooks(pkgTests, test)
+			timeout := cfg.testTimeout(pkgTests, test)
+			if cfg.count > 1 {
+				// the timeout applies to each iteration instead
+				root.runChild(test.Name, repeatTest(tester, cfg.count, cfg.countConcurrency, timeout), 0, test.resultMetadata())
+			} else if retries := cfg.testRetries(pkgTests, test); retries > 0 {
+				root.runChildWithRetries(test.Name, tester, timeout, test.resultMetadata(), retries)
+			} else {
+				root.runChild(test.Name, tester, timeout, test.resultMetadata())
+			}
+		}
+		root.waitParallel()
+
+		for _, st := range root.subtests {
+			// tests that are retried may still be running further attempts in the background
+			<-st.done
+			pkgResult = worstResult(pkgResult, st.result.Result)
+			pkgResults.Subtests = append(pkgResults.Subtests, st.result)
+		}
+	} else {
+		// BeforePackage failed or skipped, so simply mark every test the same way
+		// its messages are only in its hook result, rather than repeated for every test
+		level := LevelError
+		if beforePkgResult == ResultSkipped {
+			level = LevelInfo
+		}
+		msg := Msg{
+			Msg:   fmt.Sprintf("not run because BeforePackage %s", beforePkgResult),
+			Level: level,
+		}
+		for _, test := range pp.tests {
+			res := notRunResult(pkg, test.Name, beforePkgResult, msg)
+			res.Metadata = test.resultMetadata()
+			pkgResults.Subtests = append(pkgResults.Subtests, res)
+			cfg.emit(Event{Kind: EventTestFinished, Package: pkg, Name: test.Name, Result: &res})
+		}
+	}
+
+	hook := runHook(pkgHelperT, "AfterPackage", afterHook(pkgTests.AfterPackage, pkgHelperT))
+	// only record AfterPackage if there is one, or if a cleanup function registered by BeforePackage failed
+	if pkgTests.AfterPackage != nil || hook.Result == ResultFailed {
+		pkgResults.Hooks = append(pkgResults.Hooks, hook)
 	}
 
-	subtests := make(chan subtest)
-	subtestDone := make(chan bool)
-	t := &t{
-		name:        baseName,
-		tester:      tester,
-		subtests:    subtests,
-		subtestDone: subtestDone,
+	// update test results if AfterPackage failed
+	if hook.Result == ResultFailed {
+		pkgResult = ResultFailed
+		m := Msg{
+			Msg:   "AfterPackage failed",
+			Level: LevelError,
+		}
+		for i := range pkgResults.Subtests {
+			r := &pkgResults.Subtests[i]
+			r.Result = ResultFailed
+			r.Msgs = append(r.Msgs, m)
+		}
 	}
 
-	stWg := sync.WaitGroup{}
-	stWg.Add(1)
+	pkgResults.Result = pkgResult
+	dur := time.Since(pkgStart).Round(time.Millisecond)
+	pkgResults.Dur = dur
+	pkgResults.DurHuman = dur.String()
 
-	anyFailures := false
-	go func() {
-		defer stWg.Done()
-		for st := range subtests {
-			stResult := runTest(pkg, baseName+"/"+st.name, st.tester)
-			if stResult.Result == ResultFailed {
-				// TODO does this need to be an atomic operation?
-				anyFailures = true
+	cfg.emit(Event{Kind: EventPackageFinished, Package: pkg, Result: &pkgResults})
+	return pkgResults
+}
+
+// repeatTest returns a tester that runs tester count times as iterations of the test, up to concurrency at a time.
+func repeatTest(tester Tester, count, concurrency int, timeout time.Duration) Tester {
+	width := len(strconv.Itoa(count))
+	return func(tt TestingT) {
+		parent := tt.(*t)
+		parent.mu.Lock()
+		parent.repeated = true
+		parent.mu.Unlock()
+
+		sem := make(chan struct{}, concurrency)
+		wg := sync.WaitGroup{}
+		for i := 1; i <= count; i++ {
+			sem <- struct{}{}
+			// don't start any more iterations once we've been cancelled
+			if err := parent.ctx.Err(); err != nil {
+				<-sem
+				parent.cancelChild(fmt.Sprintf("#%0*d", width, i), err, nil)
+				continue
+			}
+
+			child := newIterationT(parent, i, width, tester, timeout)
+			parent.startChild(child)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// an iteration that calls Parallel still holds its slot, see parallelIteration
+				<-child.done
+				<-sem
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// testWithHooks wraps a registered test so that its package's BeforeTest and AfterTest are run around it.
+// Their results are recorded in the test's result, and the test fails if either of them do.
+func testWithHooks(pkgTests *testPkg, test testCase) Tester {
+	return withHooks("BeforeTest", pkgTests.BeforeTest, "AfterTest", pkgTests.AfterTest, test.tester)
+}
+
+// subtestWithHooks wraps a subtest so that its package's BeforeEach and AfterEach are run around it.
+// Their results are recorded in the subtest's result, and the subtest fails if either of them do.
+func subtestWithHooks(pkgTests *testPkg, tester Tester) Tester {
+	return withHooks("BeforeEach", pkgTests.BeforeEach, "AfterEach", pkgTests.AfterEach, tester)
+}
+
+// withHooks wraps tester so that before and after (either of which may be nil) are run around it.
+// beforeName and afterName are the names of their results.
+func withHooks(beforeName string, before Tester, afterName string, after Tester, tester Tester) Tester {
+	return func(tt TestingT) {
+		testT := tt.(*t)
+		helperT := newHelperT(testT.ctx, testT.pkg, testT.name)
+		helperT.captureLog = testT.captureLog
+
+		// defer the after function so it always runs even if the before function or the test itself fail or exit
+		defer func() {
+			hook := runHook(helperT, afterName, afterHook(after, helperT))
+			// only record the after function if there is one, or if a cleanup function registered by the before function failed
+			if after != nil || hook.Result == ResultFailed {
+				testT.addHook(hook)
+			}
+			if hook.Result == ResultFailed {
+				testT.Fail()
+			}
+		}()
+
+		if before != nil {
+			hook := runHook(helperT, beforeName, before)
+			testT.addHook(hook)
+
+			// only run the test if the before function didn't fail or skip it
+			switch hook.Result {
+			case ResultFailed:
+				testT.FailNow()
+			case ResultSkipped:
+				testT.SkipNow()
 			}
-			result.Subtests = append(result.Subtests, stResult)
-			subtestDone <- stResult.Result != ResultFailed
 		}
-	}()
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
+		tester(tt)
+	}
+}
+
+// afterHook returns a Tester that runs after, if it is not nil,
+// followed by anything the Before/After functions using helperT registered with Cleanup.
+func afterHook(after Tester, helperT *t) Tester {
+	return func(ht TestingT) {
+		defer helperT.runCleanups()
+		if after != nil {
+			after(ht)
+		}
+	}
+}
 
+// runHook runs a Before/After function with the helper ht in a new goroutine,
+// so that it can call FailNow or SkipNow to stop itself just like a test can.
+// A panic is recorded as a failure of ht with the panic's message.
+// name is the kind of function being run, and is used as the name of the returned result.
+// Since ht is shared by the functions run for the same package or test, only what this function did is in the result.
+func runHook(ht *t, name string, f Tester) TestResult {
 	start := time.Now()
-	// run in another goroutine so FailNow can work
+	ht.mu.Lock()
+	ht.failed = false
+	ht.skipped = false
+	ht.start = start
+	from := len(ht.msgs)
+	ht.mu.Unlock()
+
+	done := make(chan struct{})
 	go func() {
-		defer wg.Done()
-		t.run()
+		defer close(done)
+		if ht.captureLog {
+			logCapture.add(ht)
+			defer logCapture.remove(ht)
+		}
+		defer func() {
+			if err := recover(); err != nil {
+				ht.Errorf("panic: %v\n\n%s", err, debug.Stack())
+			}
+		}()
+		f(ht)
 	}()
-	// wait for original test to finish
-	wg.Wait()
-	// this shouldn't be needed since the test actually waits for the subtest to complete before continuing, but it
-	// doesn't hurt to be careful
-	stWg.Wait()
-	close(subtestDone)
-	dur := time.Since(start).Round(time.Millisecond)
+	<-done
 
 	r := ResultPassed
-	if t.failed || anyFailures {
+	if ht.Failed() {
 		r = ResultFailed
+	} else if ht.Skipped() {
+		r = ResultSkipped
+	}
+	dur := time.Since(start).Round(time.Millisecond)
+	return TestResult{
+		Package:  ht.pkg,
+		Name:     name,
+		Msgs:     ht.msgsFrom(from),
+		Result:   r,
+		Started:  start,
+		Dur:      dur,
+		DurHuman: dur.String(),
 	}
-	result.Msgs = t.msgs
-	result.Result = r
-	result.Started = start
-	result.Dur = dur
-	result.DurHuman = dur.String()
-	return result
 }
@@ -1,6 +1,17 @@
 package testy
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -31,6 +42,31 @@ func fails(ts *time.Time) Tester {
 	}
 }
 
+func errs(ts *time.Time) Tester {
+	return func(t TestingT) {
+		*ts = time.Now()
+		t.Logf("logged")
+		t.Errorf("errors")
+	}
+}
+
+func skips(ts *time.Time) Tester {
+	return func(t TestingT) {
+		*ts = time.Now()
+		t.Skip("skips")
+	}
+}
+
+// withoutSource keeps only the text and level of each message, so messages can be compared without when and where
+// they were emitted.
+func withoutSource(msgs []Msg) []Msg {
+	out := make([]Msg, len(msgs))
+	for i, msg := range msgs {
+		out[i] = Msg{Msg: msg.Msg, Level: msg.Level}
+	}
+	return out
+}
+
 func subtestForTest(tester Tester) Tester {
 	return func(t TestingT) {
 		b := t.Run("subtest", tester)
@@ -47,6 +83,8 @@ type runTC struct {
 	test          Tester
 	rootResult    Result
 	validate      func(*testing.T, TestResult)
+	// validatePackage optionally validates the package's result, which has the package's hooks
+	validatePackage func(*testing.T, TestResult)
 }
 
 var runTCs = []runTC{
@@ -393,18 +431,182 @@ var runTCs = []runTC{
 			assert.True(t, ap.After(at))
 
 			assert.Equal(t, ResultFailed, tr.Result)
+			assert.Len(t, tr.Msgs, 0)
+			require.Len(t, tr.Hooks, 2)
+			assert.Equal(t, "BeforeTest", tr.Hooks[0].Name)
+			assert.Equal(t, ResultFailed, tr.Hooks[0].Result)
+			assert.Len(t, tr.Hooks[0].Msgs, 1)
+			assert.Equal(t, "AfterTest", tr.Hooks[1].Name)
+			assert.Equal(t, ResultPassed, tr.Hooks[1].Result)
+
+			assert.Nil(t, subtestResult)
+		},
+	},
+	{
+		name:          "failing before package does not call before/after test or test but calls after package",
+		beforePackage: fails(&bp),
+		beforeTest:    succeeds(&bt),
+		afterTest:     succeeds(&at),
+		afterPackage:  succeeds(&ap),
+		test:          succeeds(&tt),
+		rootResult:    ResultFailed,
+		validate: func(t *testing.T, tr TestResult) {
+			assert.NotZero(t, bp)
+			assert.Zero(t, bt)
+			assert.Zero(t, tt)
+			assert.Zero(t, at)
+			assert.True(t, ap.After(bp))
+
+			assert.Equal(t, ResultFailed, tr.Result)
+			require.Len(t, tr.Msgs, 1)
+			assert.Equal(t, "not run because BeforePackage failed", tr.Msgs[0].Msg)
+			assert.Empty(t, tr.Hooks)
+
+			assert.Nil(t, subtestResult)
+		},
+		validatePackage: func(t *testing.T, pr TestResult) {
+			require.Len(t, pr.Hooks, 2)
+			assert.Equal(t, "BeforePackage", pr.Hooks[0].Name)
+			assert.Equal(t, ResultFailed, pr.Hooks[0].Result)
+			require.Len(t, pr.Hooks[0].Msgs, 1)
+			assert.Equal(t, "fails\n", pr.Hooks[0].Msgs[0].Msg)
+			assert.Equal(t, "AfterPackage", pr.Hooks[1].Name)
+			assert.Equal(t, ResultPassed, pr.Hooks[1].Result)
+		},
+	},
+	{
+		name:          "skipping before package skips tests but calls after package",
+		beforePackage: skips(&bp),
+		beforeTest:    succeeds(&bt),
+		afterTest:     succeeds(&at),
+		afterPackage:  succeeds(&ap),
+		test:          succeeds(&tt),
+		rootResult:    ResultPassed,
+		validate: func(t *testing.T, tr TestResult) {
+			assert.NotZero(t, bp)
+			assert.Zero(t, bt)
+			assert.Zero(t, tt)
+			assert.Zero(t, at)
+			assert.True(t, ap.After(bp))
+
+			assert.Equal(t, ResultSkipped, tr.Result)
 			assert.Len(t, tr.Msgs, 1)
 
 			assert.Nil(t, subtestResult)
 		},
 	},
+	{
+		name:          "erroring before test does not call test but calls after test",
+		beforePackage: succeeds(&bp),
+		beforeTest:    errs(&bt),
+		afterTest:     succeeds(&at),
+		afterPackage:  succeeds(&ap),
+		test:          succeeds(&tt),
+		rootResult:    ResultFailed,
+		validate: func(t *testing.T, tr TestResult) {
+			assert.NotZero(t, bp)
+			assert.True(t, bt.After(bp))
+			assert.Zero(t, tt)
+			assert.True(t, at.After(bt))
+			assert.True(t, ap.After(at))
+
+			assert.Equal(t, ResultFailed, tr.Result)
+			assert.Len(t, tr.Msgs, 0)
+			require.Len(t, tr.Hooks, 2)
+			assert.Equal(t, ResultFailed, tr.Hooks[0].Result)
+			require.Len(t, tr.Hooks[0].Msgs, 2)
+			assert.Equal(t, "logged", tr.Hooks[0].Msgs[0].Msg)
+			assert.Equal(t, "errors", tr.Hooks[0].Msgs[1].Msg)
+
+			assert.Nil(t, subtestResult)
+		},
+	},
+	{
+		name:          "skipping before test skips test but calls after test",
+		beforePackage: succeeds(&bp),
+		beforeTest:    skips(&bt),
+		afterTest:     succeeds(&at),
+		afterPackage:  succeeds(&ap),
+		test:          succeeds(&tt),
+		rootResult:    ResultPassed,
+		validate: func(t *testing.T, tr TestResult) {
+			assert.NotZero(t, bp)
+			assert.True(t, bt.After(bp))
+			assert.Zero(t, tt)
+			assert.True(t, at.After(bt))
+			assert.True(t, ap.After(at))
+
+			assert.Equal(t, ResultSkipped, tr.Result)
+			assert.Len(t, tr.Msgs, 0)
+			require.Len(t, tr.Hooks, 2)
+			assert.Equal(t, ResultSkipped, tr.Hooks[0].Result)
+			assert.Len(t, tr.Hooks[0].Msgs, 1)
+
+			assert.Nil(t, subtestResult)
+		},
+	},
+	{
+		name:          "failing after test fails test",
+		beforePackage: succeeds(&bp),
+		beforeTest:    succeeds(&bt),
+		afterTest:     fails(&at),
+		afterPackage:  succeeds(&ap),
+		test:          succeeds(&tt),
+		rootResult:    ResultFailed,
+		validate: func(t *testing.T, tr TestResult) {
+			assert.NotZero(t, bp)
+			assert.True(t, bt.After(bp))
+			assert.True(t, tt.After(bt))
+			assert.True(t, at.After(tt))
+			assert.True(t, ap.After(at))
+
+			assert.Equal(t, ResultFailed, tr.Result)
+			assert.Len(t, tr.Msgs, 0)
+			require.Len(t, tr.Hooks, 2)
+			assert.Equal(t, ResultPassed, tr.Hooks[0].Result)
+			assert.Equal(t, ResultFailed, tr.Hooks[1].Result)
+			assert.Len(t, tr.Hooks[1].Msgs, 1)
+
+			assert.Nil(t, subtestResult)
+		},
+	},
+	{
+		name:          "erroring after package fails test",
+		beforePackage: succeeds(&bp),
+		beforeTest:    succeeds(&bt),
+		afterTest:     succeeds(&at),
+		afterPackage:  errs(&ap),
+		test:          succeeds(&tt),
+		rootResult:    ResultFailed,
+		validate: func(t *testing.T, tr TestResult) {
+			assert.NotZero(t, bp)
+			assert.True(t, bt.After(bp))
+			assert.True(t, tt.After(bt))
+			assert.True(t, at.After(tt))
+			assert.True(t, ap.After(at))
+
+			assert.Equal(t, ResultFailed, tr.Result)
+			require.Len(t, tr.Msgs, 1)
+			assert.Equal(t, "AfterPackage failed", tr.Msgs[0].Msg)
+
+			assert.Nil(t, subtestResult)
+		},
+		validatePackage: func(t *testing.T, pr TestResult) {
+			assert.Equal(t, ResultFailed, pr.Result)
+			assert.Len(t, pr.Msgs, 0)
+			require.Len(t, pr.Hooks, 2)
+			assert.Equal(t, ResultPassed, pr.Hooks[0].Result)
+			assert.Equal(t, ResultFailed, pr.Hooks[1].Result)
+			assert.Len(t, pr.Hooks[1].Msgs, 2)
+		},
+	},
 }
 
 func TestRun(t *testing.T) {
 	for _, tc := range runTCs {
 		t.Run(tc.name, func(t *testing.T) {
 			// reset everything
-			instance = testy{}
+			instance = &Suite{}
 			bp = time.Time{}
 			bt = time.Time{}
 			at = time.Time{}
@@ -440,6 +642,1707 @@ func TestRun(t *testing.T) {
 			require.Len(t, res.Subtests[0].Subtests, 1)
 			// look into the test suite results and the package results
 			tc.validate(t, res.Subtests[0].Subtests[0])
+			if tc.validatePackage != nil {
+				tc.validatePackage(t, res.Subtests[0])
+			}
+		})
+	}
+}
+
+// recordName returns a Tester that records the full name of each test it is run for.
+func recordName(names *[]string) Tester {
+	return func(tt TestingT) {
+		*names = append(*names, tt.(*t).name)
+	}
+}
+
+func TestRunWithOptions(t *testing.T) {
+	instance = &Suite{}
+
+	var ran, hooks []string
+	Test("a", recordName(&ran))
+	Test("b", func(t TestingT) {
+		TestEach(t, []int{1, 2, 3}, func(t TestingT, _ int) {
+			recordName(&ran)(t)
+		})
+	})
+	BeforePackage(func(TestingT) {
+		hooks = append(hooks, "testy")
+	})
+
+	other := instance.getPackageTests("example.com/other")
+	other.tests["c"] = testCase{Package: other.name, Name: "c", tester: recordName(&ran)}
+	other.BeforePackage = func(TestingT) {
+		hooks = append(hooks, "other")
+	}
+
+	t.Run("everything", func(t *testing.T) {
+		ran, hooks = nil, nil
+		res, err := RunWithOptions(RunOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"c", "a", "b/1", "b/2", "b/3"}, ran)
+		assert.Equal(t, []string{"other", "testy"}, hooks)
+		assert.Len(t, res.Subtests, 2)
+	})
+
+	t.Run("package filter", func(t *testing.T) {
+		ran, hooks = nil, nil
+		res, err := RunWithOptions(RunOptions{Packages: "other$"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"c"}, ran)
+		assert.Equal(t, []string{"other"}, hooks)
+		require.Len(t, res.Subtests, 1)
+		assert.Equal(t, "example.com/other", res.Subtests[0].Package)
+	})
+
+	t.Run("test filter", func(t *testing.T) {
+		ran, hooks = nil, nil
+		res, err := RunWithOptions(RunOptions{Run: "^a$"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a"}, ran)
+		// other has no selected tests so its hooks must not run
+		assert.Equal(t, []string{"testy"}, hooks)
+		require.Len(t, res.Subtests, 1)
+		require.Len(t, res.Subtests[0].Subtests, 1)
+		assert.Equal(t, "a", res.Subtests[0].Subtests[0].Name)
+	})
+
+	t.Run("subtest filter", func(t *testing.T) {
+		ran, hooks = nil, nil
+		res, err := RunWithOptions(RunOptions{Run: "b/^2$"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b/2"}, ran)
+		require.Len(t, res.Subtests, 1)
+		require.Len(t, res.Subtests[0].Subtests, 1)
+		b := res.Subtests[0].Subtests[0]
+		require.Len(t, b.Subtests, 1)
+		assert.Equal(t, "b/2", b.Subtests[0].Name)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		ran, hooks = nil, nil
+		_, err := RunWithOptions(RunOptions{Run: "("})
+		assert.Error(t, err)
+		_, err = RunWithOptions(RunOptions{Packages: "("})
+		assert.Error(t, err)
+		assert.Nil(t, ran)
+		assert.Nil(t, hooks)
+	})
+}
+
+func TestRunPackageConcurrency(t *testing.T) {
+	instance = &Suite{}
+
+	// each package's test waits for the other package's test to start, which can only happen if they run concurrently
+	started := map[string]chan struct{}{
+		"example.com/a": make(chan struct{}),
+		"example.com/b": make(chan struct{}),
+	}
+	waitFor := func(self, other string) Tester {
+		return func(t TestingT) {
+			close(started[self])
+			select {
+			case <-started[other]:
+			case <-time.After(5 * time.Second):
+				t.Fatal("packages did not run concurrently")
+			}
+		}
+	}
+	a := instance.getPackageTests("example.com/a")
+	a.tests["test"] = testCase{Package: a.name, Name: "test", tester: waitFor(a.name, "example.com/b")}
+	b := instance.getPackageTests("example.com/b")
+	b.tests["test"] = testCase{Package: b.name, Name: "test", tester: waitFor(b.name, "example.com/a")}
+
+	res, err := RunWithOptions(RunOptions{PackageConcurrency: 2})
+	require.NoError(t, err)
+	assert.Equal(t, ResultPassed, res.Result)
+	require.Len(t, res.Subtests, 2)
+	assert.Equal(t, "example.com/a", res.Subtests[0].Package)
+	assert.Equal(t, "example.com/b", res.Subtests[1].Package)
+}
+
+func TestRunParallel(t *testing.T) {
+	t.Run("subtests run after parent and together", func(t *testing.T) {
+		instance = &Suite{}
+
+		var mu sync.Mutex
+		var events []string
+		record := func(s string) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, s)
+		}
+
+		// each parallel subtest waits for the other to start, which can only happen if they run at the same time
+		started := []chan struct{}{make(chan struct{}), make(chan struct{})}
+		Test("parent", func(t TestingT) {
+			for i := range started {
+				i := i
+				assert.True(t, t.Run(fmt.Sprint(i), func(t TestingT) {
+					t.Parallel()
+					record(fmt.Sprint("start ", i))
+					close(started[i])
+					select {
+					case <-started[1-i]:
+					case <-time.After(5 * time.Second):
+						t.Fatal("subtests did not run in parallel")
+					}
+					if i == 1 {
+						t.Errorf("fails")
+					}
+				}))
+			}
+			record("parent done")
+		})
+
+		res, err := RunWithOptions(RunOptions{Parallel: 2})
+		require.NoError(t, err)
+		assert.Equal(t, ResultFailed, res.Result)
+		require.Len(t, events, 3)
+		assert.Equal(t, "parent done", events[0])
+
+		parent := res.Subtests[0].Subtests[0]
+		assert.Equal(t, ResultFailed, parent.Result)
+		require.Len(t, parent.Subtests, 2)
+		assert.Equal(t, "parent/0", parent.Subtests[0].Name)
+		assert.Equal(t, ResultPassed, parent.Subtests[0].Result)
+		assert.Equal(t, "parent/1", parent.Subtests[1].Name)
+		assert.Equal(t, ResultFailed, parent.Subtests[1].Result)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		instance = &Suite{}
+
+		var running, maxRunning int32
+		Test("parent", func(t TestingT) {
+			TestEach(t, []int{1, 2, 3, 4}, func(t TestingT, _ int) {
+				t.Parallel()
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+			})
+		})
+
+		res, err := RunWithOptions(RunOptions{Parallel: 1})
+		require.NoError(t, err)
+		assert.Equal(t, ResultPassed, res.Result)
+		assert.Equal(t, int32(1), maxRunning)
+	})
+
+	t.Run("top level tests wait for sequential tests and AfterTest waits for the test", func(t *testing.T) {
+		instance = &Suite{}
+
+		var mu sync.Mutex
+		var events []string
+		record := func(s string) Tester {
+			return func(TestingT) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, s)
+			}
+		}
+
+		AfterTest(record("after test"))
+		AfterPackage(record("after package"))
+		Test("a parallel", func(t TestingT) {
+			t.Parallel()
+			record("a")(t)
+		})
+		Test("b sequential", record("b"))
+
+		res, err := RunWithOptions(RunOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, ResultPassed, res.Result)
+		assert.Equal(t, []string{"b", "after test", "a", "after test", "after package"}, events)
+		require.Len(t, res.Subtests[0].Subtests, 2)
+		assert.Equal(t, "a_parallel", res.Subtests[0].Subtests[0].Name)
+	})
+}
+
+func TestRunShuffle(t *testing.T) {
+	instance = &Suite{}
+
+	var ran []string
+	for _, pkg := range []string{"example.com/a", "example.com/b", "example.com/c"} {
+		pt := instance.getPackageTests(pkg)
+		for _, name := range []string{"1", "2", "3", "4"} {
+			pt.tests[name] = testCase{Package: pkg, Name: name, tester: func(t TestingT) {
+				TestEach(t, []int{1, 2, 3, 4, 5, 6}, func(t TestingT, _ int) {
+					recordName(&ran)(t)
+				})
+			}}
+		}
+	}
+
+	order := func(res TestResult) []string {
+		var names []string
+		for _, pkg := range res.Subtests {
+			for _, test := range pkg.Subtests {
+				names = append(names, pkg.Package+"."+test.Name)
+			}
+		}
+		return names
+	}
+
+	res, err := RunWithOptions(RunOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, res.Shuffle)
+	unshuffled := order(res)
+	unshuffledSubtests := ran
+
+	ran = nil
+	res, err = RunWithOptions(RunOptions{Shuffle: "on", ShuffleSubtests: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Shuffle)
+	shuffled := order(res)
+	shuffledSubtests := ran
+	assert.ElementsMatch(t, unshuffled, shuffled)
+	assert.ElementsMatch(t, unshuffledSubtests, shuffledSubtests)
+	// 12! orderings of the tests, so this is effectively guaranteed not to flake
+	assert.NotEqual(t, unshuffled, shuffled)
+
+	// replaying the seed must produce exactly the same order
+	ran = nil
+	res, err = RunWithOptions(RunOptions{Shuffle: res.Shuffle, ShuffleSubtests: true})
+	require.NoError(t, err)
+	assert.Equal(t, shuffled, order(res))
+	assert.Equal(t, shuffledSubtests, ran)
+
+	// without ShuffleSubtests, only the top level tests are shuffled
+	ran = nil
+	_, err = RunWithOptions(RunOptions{Shuffle: res.Shuffle})
+	require.NoError(t, err)
+	for i := 0; i < len(ran); i += 6 {
+		for j := 1; j < 6; j++ {
+			assert.Equal(t, fmt.Sprintf("%s/%d", ran[i][:len(ran[i])-2], j+1), ran[i+j])
+		}
+	}
+
+	_, err = RunWithOptions(RunOptions{Shuffle: "sometimes"})
+	assert.Error(t, err)
+}
+
+func TestStream(t *testing.T) {
+	instance = &Suite{}
+
+	Test("test", func(t TestingT) {
+		t.Log("hello")
+		t.Run("subtest", func(t TestingT) {})
+	})
+
+	events, err := Stream(RunOptions{})
+	require.NoError(t, err)
+
+	var kinds []EventKind
+	var names []string
+	var last Event
+	for ev := range events {
+		kinds = append(kinds, ev.Kind)
+		names = append(names, ev.Name)
+		assert.NotZero(t, ev.Time)
+		if ev.Kind == EventMsg {
+			require.NotNil(t, ev.Msg)
+			assert.Equal(t, "hello\n", ev.Msg.Msg)
+		}
+		last = ev
+	}
+
+	assert.Equal(t, []EventKind{
+		EventPackageStarted,
+		EventTestStarted,
+		EventMsg,
+		EventTestStarted,
+		EventTestFinished,
+		EventTestFinished,
+		EventPackageFinished,
+		EventSuiteFinished,
+	}, kinds)
+	assert.Equal(t, []string{"", "test", "test", "test/subtest", "test/subtest", "test", "", ""}, names)
+
+	require.NotNil(t, last.Result)
+	assert.Equal(t, ResultPassed, last.Result.Result)
+	require.Len(t, last.Result.Subtests, 1)
+	assert.Len(t, last.Result.Subtests[0].Subtests, 1)
+
+	_, err = Stream(RunOptions{Run: "("})
+	assert.Error(t, err)
+}
+
+func TestRunContext(t *testing.T) {
+	t.Run("cancelled before starting", func(t *testing.T) {
+		instance = &Suite{}
+
+		var ran []string
+		BeforePackage(recordName(&ran))
+		Test("test", recordName(&ran))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		res, err := RunContext(ctx, RunOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, ran)
+		assert.Equal(t, ResultCancelled, res.Result)
+		require.Len(t, res.Subtests, 1)
+		require.Len(t, res.Subtests[0].Subtests, 1)
+		assert.Equal(t, ResultCancelled, res.Subtests[0].Subtests[0].Result)
+		assert.Equal(t, TestStats{Total: 1, Cancelled: 1}, res.Stats())
+	})
+
+	t.Run("cancelled while running", func(t *testing.T) {
+		instance = &Suite{}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var testCtx context.Context
+		afterPackageRan := false
+		AfterPackage(func(TestingT) {
+			afterPackageRan = true
+		})
+		Test("a", func(t TestingT) {
+			testCtx = t.Context()
+			assert.NoError(t, testCtx.Err())
+			cancel()
+			assert.Error(t, testCtx.Err())
+			assert.False(t, t.Run("subtest", func(TestingT) {}))
+		})
+		Test("b", func(TestingT) {
+			assert.Fail(t, "should not have been run")
+		})
+
+		res, err := RunContext(ctx, RunOptions{})
+		require.NoError(t, err)
+		assert.True(t, afterPackageRan)
+		assert.Equal(t, ResultCancelled, res.Result)
+
+		tests := res.Subtests[0].Subtests
+		require.Len(t, tests, 2)
+		assert.Equal(t, ResultCancelled, tests[0].Result)
+		require.Len(t, tests[0].Subtests, 1)
+		assert.Equal(t, ResultCancelled, tests[0].Subtests[0].Result)
+		assert.Equal(t, "a/subtest", tests[0].Subtests[0].Name)
+		assert.Equal(t, ResultCancelled, tests[1].Result)
+		assert.Len(t, tests[1].Msgs, 1)
+	})
+
+	t.Run("test context is cancelled when the test finishes", func(t *testing.T) {
+		instance = &Suite{}
+
+		var testCtx context.Context
+		Test("test", func(t TestingT) {
+			testCtx = t.Context()
+		})
+
+		res := Run()
+		assert.Equal(t, ResultPassed, res.Result)
+		require.NotNil(t, testCtx)
+		assert.ErrorIs(t, testCtx.Err(), context.Canceled)
+	})
+}
+
+func hangs(release <-chan struct{}) Tester {
+	return func(t TestingT) {
+		t.Log("hanging")
+		<-release
+		t.Log("this should not be seen")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() {
+		close(release)
+	})
+
+	t.Run("global timeout", func(t *testing.T) {
+		instance = &Suite{}
+
+		var testCtx context.Context
+		Test("a", func(t TestingT) {
+			testCtx = t.Context()
+			t.Run("subtest", hangs(release))
+		})
+		Test("b", succeeds(&tt))
+
+		res, err := RunWithOptions(RunOptions{Timeout: 50 * time.Millisecond})
+		require.NoError(t, err)
+		assert.Equal(t, ResultFailed, res.Result)
+
+		tests := res.Subtests[0].Subtests
+		require.Len(t, tests, 2)
+		a := tests[0]
+		assert.Equal(t, ResultFailed, a.Result)
+		require.Len(t, a.Msgs, 1)
+		assert.Contains(t, a.Msgs[0].Msg, "test timed out after 50ms")
+		// the stack of the hung subtest is included
+		assert.Contains(t, a.Msgs[0].Msg, "testy.hangs")
+		require.Len(t, a.Subtests, 1)
+		assert.Equal(t, ResultFailed, a.Subtests[0].Result)
+		require.Len(t, a.Subtests[0].Msgs, 2)
+		assert.Equal(t, "hanging\n", a.Subtests[0].Msgs[0].Msg)
+
+		require.NotNil(t, testCtx)
+		assert.ErrorContains(t, context.Cause(testCtx), "timed out")
+
+		// the run continued with the next test
+		assert.Equal(t, ResultPassed, tests[1].Result)
+	})
+
+	t.Run("test and package timeouts override global", func(t *testing.T) {
+		instance = &Suite{}
+
+		PackageTimeout(50 * time.Millisecond)
+		Test("package", hangs(release))
+		Test("test", hangs(release), Timeout(10*time.Millisecond))
+		Test("passes", func(TestingT) {
+			time.Sleep(20 * time.Millisecond)
+		})
+
+		res, err := RunWithOptions(RunOptions{Timeout: time.Hour})
+		require.NoError(t, err)
+
+		tests := res.Subtests[0].Subtests
+		require.Len(t, tests, 3)
+		assert.Contains(t, tests[0].Msgs[1].Msg, "test timed out after 50ms")
+		assert.Equal(t, ResultPassed, tests[1].Result)
+		assert.Contains(t, tests[2].Msgs[1].Msg, "test timed out after 10ms")
+	})
+
+	t.Run("waiting in parallel does not count", func(t *testing.T) {
+		instance = &Suite{}
+
+		Test("a parallel", func(t TestingT) {
+			t.Parallel()
+		})
+		Test("b sequential", func(TestingT) {
+			time.Sleep(100 * time.Millisecond)
+		})
+
+		res, err := RunWithOptions(RunOptions{Timeout: 50 * time.Millisecond, Parallel: 1})
+		require.NoError(t, err)
+		assert.Equal(t, ResultFailed, res.Result)
+		tests := res.Subtests[0].Subtests
+		require.Len(t, tests, 2)
+		assert.Equal(t, ResultPassed, tests[0].Result)
+		assert.Equal(t, ResultFailed, tests[1].Result)
+	})
+
+	t.Run("abandoned parallel tests give up their slot", func(t *testing.T) {
+		instance = &Suite{}
+
+		Test("a", func(t TestingT) {
+			t.Parallel()
+			hangs(release)(t)
+		})
+		Test("b", func(t TestingT) {
+			t.Parallel()
+		})
+
+		res, err := RunWithOptions(RunOptions{Timeout: 50 * time.Millisecond, Parallel: 1})
+		require.NoError(t, err)
+		tests := res.Subtests[0].Subtests
+		require.Len(t, tests, 2)
+		assert.Equal(t, ResultFailed, tests[0].Result)
+		assert.Equal(t, ResultPassed, tests[1].Result)
+	})
+}
+
+func TestRunSkip(t *testing.T) {
+	instance = &Suite{}
+
+	var subtestPassed bool
+	Test("skipped", func(t TestingT) {
+		t.Skip("not today")
+		assert.Fail(t, "should not continue after Skip")
+	})
+	Test("subtests", func(t TestingT) {
+		subtestPassed = t.Run("skipped", func(t TestingT) {
+			t.Skipf("not %s", "today")
+		})
+		t.Run("passed", func(TestingT) {})
+	})
+	Test("failed then skipped", func(t TestingT) {
+		t.Errorf("broken")
+		t.SkipNow()
+	})
+
+	res := Run()
+	assert.True(t, subtestPassed)
+	assert.Equal(t, ResultFailed, res.Result)
+
+	// tests are run in lexicographic order
+	tests := res.Subtests[0].Subtests
+	require.Len(t, tests, 3)
+	assert.Equal(t, ResultFailed, tests[0].Result)
+
+	assert.Equal(t, ResultSkipped, tests[1].Result)
+	require.Len(t, tests[1].Msgs, 1)
+	assert.Equal(t, "not today\n", tests[1].Msgs[0].Msg)
+
+	assert.Equal(t, ResultPassed, tests[2].Result)
+	require.Len(t, tests[2].Subtests, 2)
+	assert.Equal(t, ResultSkipped, tests[2].Subtests[0].Result)
+	assert.Equal(t, ResultPassed, tests[2].Subtests[1].Result)
+
+	assert.Equal(t, TestStats{Total: 4, Passed: 1, Failed: 1, Skipped: 2}, res.Stats())
+}
+
+func TestRunCleanup(t *testing.T) {
+	t.Run("order", func(t *testing.T) {
+		instance = &Suite{}
+
+		var ran []string
+		record := func(name string) func() {
+			return func() {
+				ran = append(ran, name)
+			}
+		}
+		BeforePackage(func(t TestingT) {
+			t.Cleanup(record("before package cleanup"))
+		})
+		AfterPackage(func(TestingT) {
+			ran = append(ran, "after package")
+		})
+		BeforeTest(func(t TestingT) {
+			t.Cleanup(record("before test cleanup"))
+		})
+		AfterTest(func(TestingT) {
+			ran = append(ran, "after test")
+		})
+		Test("test", func(t TestingT) {
+			t.Cleanup(record("cleanup 1"))
+			t.Cleanup(record("cleanup 2"))
+			t.Run("subtest", func(t TestingT) {
+				t.Cleanup(record("subtest cleanup"))
+				t.Parallel()
+			})
+			ran = append(ran, "test")
+			t.FailNow()
+		})
+
+		res := Run()
+		assert.Equal(t, ResultFailed, res.Result)
+		assert.Equal(t, []string{
+			"test",
+			"after test",
+			"before test cleanup",
+			"subtest cleanup",
+			"cleanup 2",
+			"cleanup 1",
+			"after package",
+			"before package cleanup",
+		}, ran)
+	})
+
+	t.Run("panics and FailNow", func(t *testing.T) {
+		instance = &Suite{}
+
+		var ran []string
+		Test("test", func(t TestingT) {
+			t.Cleanup(func() {
+				ran = append(ran, "cleanup 1")
+			})
+			t.Cleanup(func() {
+				t.FailNow()
+			})
+			t.Cleanup(func() {
+				panic("oops")
+			})
+		})
+
+		res := Run()
+		test := res.Subtests[0].Subtests[0]
+		assert.Equal(t, ResultFailed, test.Result)
+		require.Len(t, test.Msgs, 1)
+		assert.Equal(t, "panic in cleanup: oops", test.Msgs[0].Msg)
+		assert.Equal(t, []string{"cleanup 1"}, ran)
+	})
+}
+
+func TestRunTempDir(t *testing.T) {
+	instance = &Suite{}
+
+	var dirs []string
+	Test("test", func(t TestingT) {
+		dirs = append(dirs, t.TempDir(), t.TempDir())
+		for _, dir := range dirs {
+			assert.DirExists(t, dir)
+		}
+	})
+
+	res := Run()
+	assert.Equal(t, ResultPassed, res.Result)
+	require.Len(t, dirs, 2)
+	assert.NotEqual(t, dirs[0], dirs[1])
+	for _, dir := range dirs {
+		assert.NoDirExists(t, dir)
+	}
+}
+
+func TestRunSetenv(t *testing.T) {
+	t.Setenv("TESTY_SET", "original")
+	require.NoError(t, os.Unsetenv("TESTY_UNSET"))
+
+	instance = &Suite{}
+
+	Test("set", func(t TestingT) {
+		t.Setenv("TESTY_SET", "changed")
+		t.Setenv("TESTY_UNSET", "changed")
+		assert.Equal(t, "changed", os.Getenv("TESTY_SET"))
+		assert.Equal(t, "changed", os.Getenv("TESTY_UNSET"))
+		assert.Panics(t, t.Parallel)
+	})
+	Test("parallel", func(t TestingT) {
+		t.Parallel()
+		t.Run("subtest", func(t TestingT) {
+			assert.Panics(t, func() {
+				t.Setenv("TESTY_SET", "changed")
+			})
+		})
+	})
+
+	res := Run()
+	assert.Equal(t, ResultPassed, res.Result)
+	assert.Equal(t, "original", os.Getenv("TESTY_SET"))
+	_, ok := os.LookupEnv("TESTY_UNSET")
+	assert.False(t, ok)
+}
+
+func TestRunAccessors(t *testing.T) {
+	t.Run("Name", func(t *testing.T) {
+		instance = &Suite{}
+
+		var names []string
+		record := func(t TestingT) {
+			names = append(names, t.Name())
+		}
+		BeforePackage(record)
+		BeforeTest(record)
+		Test("test", func(t TestingT) {
+			record(t)
+			t.Run("sub test", record)
+		})
+
+		Run()
+		assert.Equal(t, []string{"", "test", "test", "test/sub_test"}, names)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		instance = &Suite{}
+
+		var before, subtest, after bool
+		Test("test", func(t TestingT) {
+			before = t.Failed()
+			t.Run("subtest", func(t TestingT) {
+				t.Fail()
+				subtest = t.Failed()
+			})
+			after = t.Failed()
+		})
+
+		res := Run()
+		assert.Equal(t, ResultFailed, res.Result)
+		assert.False(t, before)
+		assert.True(t, subtest)
+		assert.True(t, after, "a failing subtest should fail its parent")
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		instance = &Suite{}
+
+		var noTimeout, withTimeout, subtest, parallel bool
+		var deadline, subtestDeadline time.Time
+		Test("a", func(t TestingT) {
+			_, noTimeout = t.Deadline()
+		})
+		Test("b", func(t TestingT) {
+			deadline, withTimeout = t.Deadline()
+			t.Run("subtest", func(t TestingT) {
+				subtestDeadline, subtest = t.Deadline()
+			})
+		}, Timeout(time.Minute))
+		Test("c", func(t TestingT) {
+			t.Parallel()
+			_, parallel = t.Deadline()
+		}, Timeout(time.Minute))
+
+		start := time.Now()
+		Run()
+		assert.False(t, noTimeout)
+		assert.True(t, withTimeout)
+		assert.WithinDuration(t, start.Add(time.Minute), deadline, time.Second)
+		assert.True(t, subtest)
+		assert.Equal(t, deadline, subtestDeadline)
+		assert.True(t, parallel)
+	})
+
+	t.Run("Deadline from context", func(t *testing.T) {
+		instance = &Suite{}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		defer cancel()
+		want, _ := ctx.Deadline()
+
+		var got time.Time
+		Test("a", func(t TestingT) {
+			got, _ = t.Deadline()
+		}, Timeout(2*time.Hour))
+
+		_, err := RunContext(ctx, RunOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestRunSuiteHooks(t *testing.T) {
+	t.Run("order", func(t *testing.T) {
+		instance = &Suite{}
+
+		var ran []string
+		record := func(name string) Tester {
+			return func(TestingT) {
+				ran = append(ran, name)
+			}
+		}
+		BeforeSuite(record("before suite"))
+		AfterSuite(record("after suite"))
+		BeforePackage(record("before package"))
+		AfterPackage(record("after package"))
+		Test("test", record("test"))
+
+		res := Run()
+		assert.Equal(t, ResultPassed, res.Result)
+		assert.Equal(t, []string{"before suite", "before package", "test", "after package", "after suite"}, ran)
+		require.Len(t, res.Hooks, 2)
+		assert.Equal(t, "BeforeSuite", res.Hooks[0].Name)
+		assert.Equal(t, ResultPassed, res.Hooks[0].Result)
+		assert.Equal(t, "AfterSuite", res.Hooks[1].Name)
+		assert.Equal(t, ResultPassed, res.Hooks[1].Result)
+	})
+
+	t.Run("before suite fails", func(t *testing.T) {
+		instance = &Suite{}
+
+		var ran []string
+		BeforeSuite(func(t TestingT) {
+			t.Fatal("unreachable")
+		})
+		AfterSuite(recordName(&ran))
+		BeforePackage(recordName(&ran))
+		Test("a", recordName(&ran))
+		Test("b", recordName(&ran))
+
+		res := Run()
+		assert.Equal(t, ResultFailed, res.Result)
+		assert.Equal(t, []string{""}, ran, "only AfterSuite should have run")
+		require.Len(t, res.Hooks, 2)
+		assert.Equal(t, ResultFailed, res.Hooks[0].Result)
+		require.Len(t, res.Hooks[0].Msgs, 1)
+		assert.Equal(t, "unreachable\n", res.Hooks[0].Msgs[0].Msg)
+
+		require.Len(t, res.Subtests, 1)
+		assert.Empty(t, res.Subtests[0].Hooks)
+		tests := res.Subtests[0].Subtests
+		require.Len(t, tests, 2)
+		for _, test := range tests {
+			assert.Equal(t, ResultFailed, test.Result)
+			require.Len(t, test.Msgs, 1)
+			assert.Equal(t, "not run because BeforeSuite failed", test.Msgs[0].Msg)
+		}
+		assert.Equal(t, TestStats{Total: 2, Failed: 2}, res.Stats())
+	})
+
+	t.Run("after suite fails", func(t *testing.T) {
+		instance = &Suite{}
+
+		AfterSuite(func(t TestingT) {
+			t.Errorf("teardown failed")
+		})
+		Test("test", func(TestingT) {})
+
+		res := Run()
+		assert.Equal(t, ResultFailed, res.Result)
+		require.Len(t, res.Hooks, 1)
+		assert.Equal(t, ResultFailed, res.Hooks[0].Result)
+		test := res.Subtests[0].Subtests[0]
+		assert.Equal(t, ResultFailed, test.Result)
+		require.Len(t, test.Msgs, 1)
+		assert.Equal(t, "AfterSuite failed", test.Msgs[0].Msg)
+	})
+}
+
+func TestRunEachHooks(t *testing.T) {
+	instance = &Suite{}
+
+	var ran []string
+	BeforeTest(func(t TestingT) {
+		ran = append(ran, "before test "+t.Name())
+	})
+	BeforeEach(func(t TestingT) {
+		ran = append(ran, "before each "+t.Name())
+		t.Cleanup(func() {
+			ran = append(ran, "cleanup "+t.Name())
+		})
+		if strings.HasSuffix(t.Name(), "fails") {
+			t.Fatal("setup failed")
+		}
+	})
+	AfterEach(func(t TestingT) {
+		ran = append(ran, "after each "+t.Name())
+	})
+	Test("test", func(t TestingT) {
+		t.Run("a", func(t TestingT) {
+			t.Run("b", recordName(&ran))
+		})
+		t.Run("fails", recordName(&ran))
+	})
+
+	res := Run()
+	assert.Equal(t, ResultFailed, res.Result)
+	assert.Equal(t, []string{
+		"before test test",
+		"before each test/a",
+		"before each test/a/b",
+		"test/a/b",
+		"after each test/a/b",
+		"cleanup test/a/b",
+		"after each test/a",
+		"cleanup test/a",
+		"before each test/fails",
+		"after each test/fails",
+		"cleanup test/fails",
+	}, ran)
+
+	test := res.Subtests[0].Subtests[0]
+	assert.Len(t, test.Hooks, 1, "only BeforeTest")
+	require.Len(t, test.Subtests, 2)
+
+	a := test.Subtests[0]
+	assert.Equal(t, ResultPassed, a.Result)
+	require.Len(t, a.Hooks, 2)
+	assert.Equal(t, "BeforeEach", a.Hooks[0].Name)
+	assert.Equal(t, "AfterEach", a.Hooks[1].Name)
+	require.Len(t, a.Subtests, 1)
+	assert.Len(t, a.Subtests[0].Hooks, 2)
+
+	fails := test.Subtests[1]
+	assert.Equal(t, ResultFailed, fails.Result)
+	require.Len(t, fails.Hooks, 2)
+	assert.Equal(t, ResultFailed, fails.Hooks[0].Result)
+}
+
+func TestRunMetadata(t *testing.T) {
+	instance = &Suite{}
+
+	var ran []string
+	Test("smoke", recordName(&ran), Tags("smoke"), Owner("core"))
+	Test("payments", func(t TestingT) {
+		t.Run("subtest", recordName(&ran))
+	}, Tags("smoke", "payments"), Owner("checkout"), Description("pays"))
+	Test("untagged", recordName(&ran))
+
+	t.Run("copied to results", func(t *testing.T) {
+		ran = nil
+		res := Run()
+		assert.Equal(t, []string{"payments/subtest", "smoke", "untagged"}, ran)
+		tests := res.Subtests[0].Subtests
+		require.Len(t, tests, 3)
+		require.NotNil(t, tests[0].Metadata)
+		assert.Equal(t, Metadata{Tags: []string{"smoke", "payments"}, Owner: "checkout", Description: "pays"}, *tests[0].Metadata)
+		require.Len(t, tests[0].Subtests, 1)
+		assert.Nil(t, tests[0].Subtests[0].Metadata)
+		assert.Nil(t, tests[2].Metadata)
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		ran = nil
+		_, err := RunWithOptions(RunOptions{Tags: []string{"payments", "other"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"payments/subtest"}, ran)
+	})
+
+	t.Run("owners", func(t *testing.T) {
+		ran = nil
+		_, err := RunWithOptions(RunOptions{Owners: []string{"core"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"smoke"}, ran)
+	})
+
+	t.Run("tags and owners", func(t *testing.T) {
+		ran = nil
+		_, err := RunWithOptions(RunOptions{Tags: []string{"smoke"}, Owners: []string{"checkout"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"payments/subtest"}, ran)
+	})
+}
+
+func TestRunProfile(t *testing.T) {
+	instance = &Suite{}
+
+	var ran []string
+	Test("smoke", recordName(&ran), Tags("smoke"))
+	Test("slow", recordName(&ran))
+	RegisterProfile("smoke", RunOptions{Tags: []string{"smoke"}})
+
+	assert.Panics(t, func() {
+		RegisterProfile("smoke", RunOptions{})
+	}, "duplicate profile")
+	assert.Panics(t, func() {
+		RegisterProfile("invalid", RunOptions{Run: "("})
+	}, "invalid options")
+
+	_, ok := ProfileOptions("nightly")
+	assert.False(t, ok)
+
+	opts, ok := ProfileOptions("smoke")
+	require.True(t, ok)
+	assert.Equal(t, "smoke", opts.Profile)
+
+	res, err := RunWithOptions(opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"smoke"}, ran)
+	assert.Equal(t, "smoke", res.Profile)
+
+	db := &InMemoryDB{}
+	_, err = db.Save(context.Background(), res)
+	require.NoError(t, err)
+	_, err = db.Save(context.Background(), Run())
+	require.NoError(t, err)
+
+	all, _, err := db.Enumerate(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	smoke, _, err := db.EnumerateProfile(context.Background(), "smoke", 1)
+	require.NoError(t, err)
+	require.Len(t, smoke, 1)
+	assert.Equal(t, "smoke", smoke[0].Profile)
+	assert.Equal(t, 1, smoke[0].Total)
+}
+
+func TestRunRegisterConcurrently(t *testing.T) {
+	instance = &Suite{}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	require.NoError(t, RegisterTest("generated", "first", func(t TestingT) {
+		close(started)
+		<-release
+	}))
+
+	done := make(chan TestResult)
+	go func() {
+		done <- Run()
+	}()
+
+	// registering and unregistering while a run is in progress must not affect it
+	<-started
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, RegisterTest("generated", fmt.Sprintf("later %d", i), func(t TestingT) {}))
+		}(i)
+	}
+	wg.Wait()
+	assert.True(t, UnregisterTest("generated", "first"))
+	assert.NoError(t, RegisterPackageHook("generated", HookBeforePackage, func(t TestingT) { t.FailNow() }))
+	close(release)
+
+	res := <-done
+	require.Len(t, res.Subtests, 1)
+	assert.Equal(t, ResultPassed, res.Result)
+	require.Len(t, res.Subtests[0].Subtests, 1)
+	assert.Equal(t, "first", res.Subtests[0].Subtests[0].Name)
+	assert.Empty(t, res.Subtests[0].Hooks)
+
+	// but the next run sees them
+	res = Run()
+	require.Len(t, res.Subtests, 1)
+	assert.Equal(t, ResultFailed, res.Result)
+	assert.Len(t, res.Subtests[0].Subtests, 10)
+	require.Len(t, res.Subtests[0].Hooks, 1)
+	assert.Equal(t, "BeforePackage", res.Subtests[0].Hooks[0].Name)
+}
+
+func TestRunRetries(t *testing.T) {
+	instance = &Suite{}
+
+	// each test fails until it has been run the given number of times
+	failUntil := func(runs *int32, n int32) Tester {
+		return func(t TestingT) {
+			if atomic.AddInt32(runs, 1) < n {
+				t.Errorf("attempt %d failed", atomic.LoadInt32(runs))
+			}
+		}
+	}
+
+	var beforeTest, afterTest int32
+	BeforeTest(func(TestingT) { atomic.AddInt32(&beforeTest, 1) })
+	AfterTest(func(TestingT) { atomic.AddInt32(&afterTest, 1) })
+
+	var broken, flaky, parallel, passing int32
+	Test("broken", failUntil(&broken, 10), Retries(1))
+	Test("flaky", failUntil(&flaky, 3))
+	Test("parallel", func(t TestingT) {
+		t.Parallel()
+		t.Run("subtest", failUntil(&parallel, 2))
+	})
+	Test("passing", failUntil(&passing, 0))
+
+	events, err := Stream(RunOptions{Retries: 3})
+	require.NoError(t, err)
+
+	started := map[string]int{}
+	retried := map[string]int{}
+	finished := map[string]int{}
+	var res TestResult
+	for ev := range events {
+		switch ev.Kind {
+		case EventTestStarted:
+			started[ev.Name]++
+		case EventTestRetried:
+			retried[ev.Name]++
+			assert.Equal(t, ResultFailed, ev.Result.Result)
+		case EventTestFinished:
+			finished[ev.Name]++
+		case EventSuiteFinished:
+			res = *ev.Result
+		}
+	}
+
+	assert.Equal(t, map[string]int{"broken": 1, "flaky": 1, "parallel": 1, "parallel/subtest": 2, "passing": 1}, started)
+	assert.Equal(t, map[string]int{"broken": 1, "flaky": 2, "parallel": 1}, retried)
+	assert.Equal(t, map[string]int{"broken": 1, "flaky": 1, "parallel": 1, "parallel/subtest": 2, "passing": 1}, finished)
+	assert.EqualValues(t, 2, broken)
+	assert.EqualValues(t, 3, flaky)
+	assert.EqualValues(t, 2, parallel)
+	assert.EqualValues(t, 1, passing)
+	assert.EqualValues(t, 8, beforeTest, "BeforeTest is run for every attempt")
+	assert.EqualValues(t, 8, afterTest, "AfterTest is run for every attempt")
+
+	assert.Equal(t, ResultFailed, res.Result)
+	require.Len(t, res.Subtests, 1)
+	tests := res.Subtests[0].Subtests
+	require.Len(t, tests, 4)
+
+	assert.Equal(t, "broken", tests[0].Name)
+	assert.Equal(t, ResultFailed, tests[0].Result)
+	require.Len(t, tests[0].Attempts, 1)
+	assert.Equal(t, ResultFailed, tests[0].Attempts[0].Result)
+	assert.Equal(t, []Msg{{Msg: "attempt 1 failed", Level: LevelError}}, withoutSource(tests[0].Attempts[0].Msgs))
+	assert.Equal(t, []Msg{{Msg: "attempt 2 failed", Level: LevelError}}, withoutSource(tests[0].Msgs))
+
+	assert.Equal(t, "flaky", tests[1].Name)
+	assert.Equal(t, ResultFlaky, tests[1].Result)
+	require.Len(t, tests[1].Attempts, 2)
+	assert.Equal(t, []Msg{{Msg: "attempt 2 failed", Level: LevelError}}, withoutSource(tests[1].Attempts[1].Msgs))
+	assert.Empty(t, tests[1].Msgs)
+	for _, attempt := range tests[1].Attempts {
+		assert.Len(t, attempt.Hooks, 2, "each attempt records its own BeforeTest and AfterTest")
+	}
+
+	assert.Equal(t, "parallel", tests[2].Name)
+	assert.Equal(t, ResultFlaky, tests[2].Result)
+	require.Len(t, tests[2].Attempts, 1)
+	require.Len(t, tests[2].Attempts[0].Subtests, 1)
+	assert.Equal(t, ResultFailed, tests[2].Attempts[0].Subtests[0].Result)
+	require.Len(t, tests[2].Subtests, 1)
+	assert.Equal(t, ResultPassed, tests[2].Subtests[0].Result)
+
+	assert.Equal(t, "passing", tests[3].Name)
+	assert.Equal(t, ResultPassed, tests[3].Result)
+	assert.Empty(t, tests[3].Attempts)
+
+	assert.Equal(t, TestStats{Total: 4, Passed: 1, Failed: 1, Flaky: 2}, res.Stats())
+
+	t.Run("flaky does not fail the run", func(t *testing.T) {
+		flaky = 0
+		res, err := RunWithOptions(RunOptions{Run: "flaky", Retries: 3})
+		require.NoError(t, err)
+		assert.Equal(t, ResultFlaky, res.Result)
+		assert.Equal(t, ResultFlaky, res.Subtests[0].Result)
+	})
+
+	t.Run("no retries", func(t *testing.T) {
+		flaky = 0
+		res, err := RunWithOptions(RunOptions{Run: "flaky"})
+		require.NoError(t, err)
+		assert.Equal(t, ResultFailed, res.Result)
+		assert.Empty(t, res.Subtests[0].Subtests[0].Attempts)
+	})
+}
+
+func TestRunFailFast(t *testing.T) {
+	instance = &Suite{}
+
+	var ran []string
+	fail := func(t TestingT) {
+		recordName(&ran)(t)
+		t.FailNow()
+	}
+	var afterTest, afterPackage []string
+	AfterTest(recordName(&afterTest))
+	AfterPackage(func(TestingT) { afterPackage = append(afterPackage, "github.com/gametimesf/testy") })
+	Test("a", fail)
+	Test("b", recordName(&ran))
+	Test("c", fail, Retries(1))
+	require.NoError(t, RegisterTest("later/pkg", "d", recordName(&ran)))
+
+	t.Run("first failure", func(t *testing.T) {
+		ran, afterTest, afterPackage = nil, nil, nil
+		res, err := RunWithOptions(RunOptions{FailFast: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a"}, ran)
+		assert.Equal(t, []string{"a"}, afterTest)
+		assert.Equal(t, []string{"github.com/gametimesf/testy"}, afterPackage)
+
+		assert.Equal(t, ResultFailed, res.Result)
+		require.Len(t, res.Subtests, 2)
+		tests := res.Subtests[0].Subtests
+		require.Len(t, tests, 3)
+		assert.Equal(t, ResultFailed, tests[0].Result)
+		for _, tr := range append(tests[1:], res.Subtests[1].Subtests...) {
+			assert.Equal(t, ResultCancelled, tr.Result, tr.Name)
+			assert.Equal(t, []Msg{{
+				Msg:   "not run: the run was stopped by FailFast after 1 failed test(s)",
+				Level: LevelError,
+			}}, tr.Msgs)
+		}
+		assert.Equal(t, ResultCancelled, res.Subtests[1].Result)
+	})
+
+	t.Run("after retries", func(t *testing.T) {
+		ran, afterTest, afterPackage = nil, nil, nil
+		res, err := RunWithOptions(RunOptions{FailFast: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c", "c"}, ran)
+		assert.Equal(t, []string{"a", "b", "c", "c"}, afterTest)
+		require.Len(t, res.Subtests, 2)
+		assert.Len(t, res.Subtests[0].Subtests[2].Attempts, 1)
+		assert.Equal(t, ResultCancelled, res.Subtests[1].Subtests[0].Result)
+	})
+
+	t.Run("started tests finish", func(t *testing.T) {
+		instance = &Suite{}
+
+		release := make(chan struct{})
+		var finished atomic.Bool
+		Test("a", func(t TestingT) {
+			t.Parallel()
+			<-release
+			finished.Store(true)
+		})
+		Test("b", func(t TestingT) {
+			t.Parallel()
+			defer close(release)
+			t.FailNow()
+		})
+		Test("c", func(t TestingT) {})
+
+		res, err := RunWithOptions(RunOptions{FailFast: 1, Parallel: 2})
+		require.NoError(t, err)
+		assert.True(t, finished.Load())
+		tests := res.Subtests[0].Subtests
+		require.Len(t, tests, 3)
+		assert.Equal(t, ResultPassed, tests[0].Result)
+		assert.Equal(t, ResultFailed, tests[1].Result)
+		// c was started before a and b were allowed to run in parallel
+		assert.Equal(t, ResultPassed, tests[2].Result)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		instance = &Suite{}
+
+		Test("a", func(t TestingT) { t.FailNow() })
+		Test("b", func(t TestingT) {})
+
+		res, err := RunWithOptions(RunOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, ResultPassed, res.Subtests[0].Subtests[1].Result)
+	})
+}
+
+func TestRunCount(t *testing.T) {
+	instance = &Suite{}
+
+	var runs, beforeTest int32
+	BeforeTest(func(TestingT) { atomic.AddInt32(&beforeTest, 1) })
+	Test("test", func(t TestingT) {
+		n := atomic.AddInt32(&runs, 1)
+		t.Run("sub", func(t TestingT) {
+			if n%4 == 0 {
+				t.Errorf("run %d failed", n)
+			}
+		})
+		t.Run("other", func(t TestingT) {})
+	}, Owner("core"))
+
+	res, err := RunWithOptions(RunOptions{Count: 12, Run: "test/sub"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 12, runs)
+	assert.EqualValues(t, 12, beforeTest, "BeforeTest is run for every iteration")
+
+	require.Len(t, res.Subtests, 1)
+	require.Len(t, res.Subtests[0].Subtests, 1)
+	tr := res.Subtests[0].Subtests[0]
+	assert.Equal(t, ResultFailed, tr.Result)
+	assert.Equal(t, &Metadata{Owner: "core"}, tr.Metadata)
+	require.Len(t, tr.Subtests, 12)
+	for i, it := range tr.Subtests {
+		assert.Equal(t, fmt.Sprintf("test/#%02d", i+1), it.Name)
+		require.Len(t, it.Subtests, 1, "the filter matches the subtests of each iteration")
+		assert.Equal(t, fmt.Sprintf("test/#%02d/sub", i+1), it.Subtests[0].Name)
+	}
+	require.NotNil(t, tr.Iterations)
+	assert.Equal(t, 12, tr.Iterations.Count)
+	assert.Equal(t, 9, tr.Iterations.Passed)
+	assert.Equal(t, 3, tr.Iterations.Failed)
+	assert.Equal(t, 75.0, tr.Iterations.PassRate)
+	assert.LessOrEqual(t, tr.Iterations.Min, tr.Iterations.Median)
+	assert.LessOrEqual(t, tr.Iterations.Median, tr.Iterations.P95)
+	assert.LessOrEqual(t, tr.Iterations.P95, tr.Iterations.Max)
+
+	t.Run("concurrently", func(t *testing.T) {
+		instance = &Suite{}
+
+		var running, most int32
+		Test("test", func(t TestingT) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&most)
+				if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+		})
+
+		res, err := RunWithOptions(RunOptions{Count: 8, CountConcurrency: 4})
+		require.NoError(t, err)
+		tr := res.Subtests[0].Subtests[0]
+		assert.Equal(t, ResultPassed, tr.Result)
+		assert.Len(t, tr.Subtests, 8)
+		assert.Equal(t, "test/#1", tr.Subtests[0].Name)
+		assert.Equal(t, 100.0, tr.Iterations.PassRate)
+		assert.Greater(t, most, int32(1))
+		assert.LessOrEqual(t, most, int32(4))
+	})
+
+	t.Run("once", func(t *testing.T) {
+		instance = &Suite{}
+
+		Test("test", func(t TestingT) {})
+		res, err := RunWithOptions(RunOptions{Count: 1})
+		require.NoError(t, err)
+		tr := res.Subtests[0].Subtests[0]
+		assert.Empty(t, tr.Subtests)
+		assert.Nil(t, tr.Iterations)
+	})
+}
+
+// assertPositive fails t at the caller's location, which is reported instead of its own.
+func assertPositive(t TestingT, n int) {
+	t.Helper()
+	if n <= 0 {
+		t.Errorf("%d is not positive", n)
+	}
+}
+
+func TestRunMsgSource(t *testing.T) {
+	instance = &Suite{}
+
+	var logLine, helperLine, panicLine int
+	line := func() int {
+		_, _, l, _ := runtime.Caller(1)
+		return l
+	}
+	Test("source", func(t TestingT) {
+		logLine = line() + 1
+		t.Log("logged")
+		time.Sleep(time.Millisecond)
+		helperLine = line() + 1
+		assertPositive(t, 0)
+	})
+	Test("panic", func(TestingT) {
+		panicLine = line() + 1
+		panic("boom")
+	})
+	BeforePackage(func(t TestingT) {
+		t.Log("hook")
+	})
+
+	res := Run()
+	require.Len(t, res.Subtests, 1)
+	pr := res.Subtests[0]
+	require.Len(t, pr.Hooks, 1)
+	require.Len(t, pr.Hooks[0].Msgs, 1)
+	assert.Equal(t, "run_test.go", filepath.Base(pr.Hooks[0].Msgs[0].File))
+
+	require.Len(t, pr.Subtests, 2)
+	msgs := pr.Subtests[1].Msgs
+	require.Len(t, msgs, 2)
+	for i, want := range []int{logLine, helperLine} {
+		assert.True(t, strings.HasSuffix(msgs[i].File, "run_test.go"), msgs[i].File)
+		assert.Equal(t, want, msgs[i].Line)
+		assert.Equal(t, fmt.Sprintf("run_test.go:%d", want), msgs[i].Location())
+	}
+	assert.Equal(t, "0 is not positive", msgs[1].Msg)
+	assert.Greater(t, msgs[0].Offset, time.Duration(0))
+	assert.GreaterOrEqual(t, msgs[1].Offset-msgs[0].Offset, time.Millisecond)
+
+	msgs = pr.Subtests[0].Msgs
+	require.Len(t, msgs, 1)
+	assert.Equal(t, panicLine, msgs[0].Line, "panics point at where they were raised")
+}
+
+func TestRunLogger(t *testing.T) {
+	instance = &Suite{}
+
+	var logLine int
+	Test("logger", func(t TestingT) {
+		logger := t.Logger().With("service", "api").WithGroup("request")
+		_, _, logLine, _ = runtime.Caller(0)
+		logger.Debug("dump", "method", "GET", slog.Group("headers", "accept", "json"))
+		logger.Info("info")
+		logger.Warn("deprecated", slog.Int("status", 299))
+		logger.Error("error")
+		logger.Log(t.Context(), slog.LevelDebug-4, "trace")
+	})
+
+	res := Run()
+	require.Len(t, res.Subtests, 1)
+	require.Len(t, res.Subtests[0].Subtests, 1)
+	tr := res.Subtests[0].Subtests[0]
+	assert.Equal(t, ResultPassed, tr.Result, "logging errors does not fail the test")
+
+	msgs := tr.Msgs
+	require.Len(t, msgs, 5)
+	assert.Equal(t, Msg{Msg: "dump", Level: LevelDebug, Attrs: []Attr{
+		{Key: "service", Value: "api"},
+		{Key: "request.method", Value: "GET"},
+		{Key: "request.headers.accept", Value: "json"},
+	}}, Msg{Msg: msgs[0].Msg, Level: msgs[0].Level, Attrs: msgs[0].Attrs})
+	assert.Equal(t, "run_test.go", filepath.Base(msgs[0].File))
+	assert.Equal(t, logLine+1, msgs[0].Line)
+
+	assert.Equal(t, []Msg{
+		{Msg: "dump", Level: LevelDebug},
+		{Msg: "info", Level: LevelInfo},
+		{Msg: "deprecated", Level: LevelWarn},
+		{Msg: "error", Level: LevelError},
+		{Msg: "trace", Level: LevelDebug},
+	}, withoutSource(msgs))
+	assert.Equal(t, []Attr{{Key: "service", Value: "api"}, {Key: "request.status", Value: "299"}}, msgs[2].Attrs)
+}
+
+func TestRunCaptureLog(t *testing.T) {
+	instance = &Suite{}
+
+	var buf bytes.Buffer
+	prevOutput, prevFlags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(prevOutput)
+		log.SetFlags(prevFlags)
+	})
+
+	var logLine int
+	BeforePackage(func(TestingT) {
+		log.Print("before package")
+	})
+	Test("a", func(t TestingT) {
+		_, _, logLine, _ = runtime.Caller(0)
+		log.Print("in a")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			log.Print("in a goroutine")
+		}()
+		<-done
+		t.Run("sub", func(TestingT) {
+			log.Print("in a/sub")
+		})
+		fmt.Fprint(t.Output(), "first\nsecond\nthird")
+	})
+
+	t.Run("captured", func(t *testing.T) {
+		res, err := RunWithOptions(RunOptions{CaptureLog: true})
+		require.NoError(t, err)
+		assert.Same(t, &buf, log.Writer(), "the standard logger's output is restored")
+		assert.Equal(t, "in a goroutine\n", buf.String(), "only the output of the test's own goroutine is captured")
+
+		require.Len(t, res.Subtests, 1)
+		pr := res.Subtests[0]
+		require.Len(t, pr.Hooks, 1)
+		assert.Equal(t, []Msg{{Msg: "before package\n", Level: LevelInfo}}, withoutSource(pr.Hooks[0].Msgs))
+
+		require.Len(t, pr.Subtests, 1)
+		tr := pr.Subtests[0]
+		assert.Equal(t, []Msg{
+			{Msg: "in a\n", Level: LevelInfo},
+			{Msg: "first\n", Level: LevelInfo},
+			{Msg: "second\n", Level: LevelInfo},
+			{Msg: "third", Level: LevelInfo},
+		}, withoutSource(tr.Msgs))
+		assert.Equal(t, logLine+1, tr.Msgs[0].Line, "the location is that of the call to the log package")
+		require.Len(t, tr.Subtests, 1)
+		assert.Equal(t, []Msg{{Msg: "in a/sub\n", Level: LevelInfo}}, withoutSource(tr.Subtests[0].Msgs))
+	})
+
+	t.Run("not captured", func(t *testing.T) {
+		buf.Reset()
+		res, err := RunWithOptions(RunOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "before package\nin a\nin a goroutine\nin a/sub\n", buf.String())
+		assert.Len(t, res.Subtests[0].Subtests[0].Msgs, 3, "only the output of Output is added")
+	})
+}
+
+func TestRunCaptureLogStream(t *testing.T) {
+	instance = &Suite{}
+
+	var buf bytes.Buffer
+	prevOutput, prevFlags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(prevOutput)
+		log.SetFlags(prevFlags)
+	})
+
+	Test("slow", func(TestingT) {
+		log.Print("in test")
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	events, err := Stream(RunOptions{CaptureLog: true})
+	require.NoError(t, err)
+	var msgs []Msg
+	var n int
+	// a consumer that logs every event, such as one shipping them elsewhere, must not see its own output as events
+	for ev := range events {
+		n++
+		log.Printf("event %s", ev.Kind)
+		if ev.Kind == EventMsg {
+			msgs = append(msgs, *ev.Msg)
+		}
+	}
+	assert.Equal(t, []Msg{{Msg: "in test\n", Level: LevelInfo}}, withoutSource(msgs))
+	assert.Equal(t, n, strings.Count(buf.String(), "event "), "the consumer's output is not captured")
+	assert.NotContains(t, buf.String(), "in test")
+}
+
+func TestRunCountParallel(t *testing.T) {
+	instance = &Suite{}
+
+	// running tracks how many iterations of "repeated" run at once
+	var mu sync.Mutex
+	var running, maxRunning int
+	// when withOther is set, the first iteration of "repeated" and the first of "other" wait for each other to be running
+	var withOther bool
+	var repeatedStarted, otherStarted chan struct{}
+	var repeatedOnce, otherOnce *sync.Once
+	waitFor := func(ch chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		case <-time.After(5 * time.Second):
+			return false
+		}
+	}
+
+	Test("repeated", func(t TestingT) {
+		t.Parallel()
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		if withOther {
+			repeatedOnce.Do(func() {
+				close(repeatedStarted)
+				if !waitFor(otherStarted) {
+					t.Errorf("other did not run in parallel")
+				}
+			})
+		}
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	Test("other", func(t TestingT) {
+		t.Parallel()
+		otherOnce.Do(func() {
+			close(otherStarted)
+			if !waitFor(repeatedStarted) {
+				t.Errorf("repeated did not run in parallel")
+			}
 		})
+	})
+
+	for _, concurrency := range []int{0, 2} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			maxRunning, withOther = 0, false
+			res, err := RunWithOptions(RunOptions{
+				Count:            5,
+				CountConcurrency: concurrency,
+				Run:              "^repeated$",
+				Parallel:         4,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, ResultPassed, res.Result)
+			require.Len(t, res.Subtests[0].Subtests, 1)
+			assert.Len(t, res.Subtests[0].Subtests[0].Subtests, 5)
+			assert.Equal(t, max(concurrency, 1), maxRunning, "parallel iterations are limited by CountConcurrency")
+		})
+	}
+
+	t.Run("with other tests", func(t *testing.T) {
+		maxRunning, withOther = 0, true
+		repeatedStarted, otherStarted = make(chan struct{}), make(chan struct{})
+		repeatedOnce, otherOnce = new(sync.Once), new(sync.Once)
+		res, err := RunWithOptions(RunOptions{Count: 3, Parallel: 4})
+		require.NoError(t, err)
+		assert.Equal(t, ResultPassed, res.Result, "the repeated test runs in parallel with other parallel tests")
+		assert.Equal(t, 1, maxRunning)
+	})
+}
+
+// logsName returns a tester that logs its name, so that loggedLines shows which tests were run.
+func logsName(t TestingT) {
+	t.Log("ran", t.Name())
+}
+
+func TestRunAsTestPackageHooks(t *testing.T) {
+	if helperProcess() {
+		var s Suite
+		for _, pkg := range []string{"p", "q", "r"} {
+			// test names must differ between packages, or go test makes them unique itself
+			require.NoError(t, s.RegisterTest(pkg, pkg+"-test", logsName))
+		}
+		require.NoError(t, s.RegisterPackageHook("q", HookBeforePackage, func(t TestingT) {
+			t.Errorf("q setup failed")
+		}))
+		require.NoError(t, s.RegisterPackageHook("q", HookAfterPackage, func(t TestingT) {
+			t.Log("q torn down")
+		}))
+		require.NoError(t, s.RegisterPackageHook("r", HookAfterPackage, func(t TestingT) {
+			t.Fatal("r teardown failed")
+		}))
+		s.RunAsTest(t)
+		return
+	}
+
+	lines, failed := loggedLines(t, t.Name())
+	assert.True(t, failed)
+	assert.Equal(t, []string{
+		"ran p-test",
+		"BeforePackage: q setup failed",
+		"AfterPackage: q torn down",
+		"BeforePackage failed for package q",
+		// a failing package does not stop the ones after it
+		"ran r-test",
+		"AfterPackage: r teardown failed",
+		"AfterPackage failed for package r",
+	}, lines)
+}
+
+func TestRunAsTestSuiteHooks(t *testing.T) {
+	if helperProcess() {
+		var passing, failing Suite
+		require.NoError(t, passing.RegisterTest("p", "a", logsName))
+		passing.BeforeSuite(func(t TestingT) { t.Log("set up") })
+		passing.AfterSuite(func(t TestingT) { t.Errorf("teardown failed") })
+
+		require.NoError(t, failing.RegisterTest("p", "a", logsName))
+		failing.BeforeSuite(func(t TestingT) {
+			t.Cleanup(func() { t.Log("cleaned up") })
+			t.Fatal("setup failed")
+		})
+		failing.AfterSuite(func(t TestingT) { t.Log("torn down") })
+
+		t.Run("passing", passing.RunAsTest)
+		t.Run("failing", failing.RunAsTest)
+		return
+	}
+
+	lines, failed := loggedLines(t, t.Name())
+	assert.True(t, failed)
+	assert.Equal(t, []string{
+		"BeforeSuite: set up",
+		"ran a",
+		"AfterSuite: teardown failed",
+		"AfterSuite failed",
+		"BeforeSuite: setup failed",
+		"BeforeSuite failed",
+		// AfterSuite and the cleanup functions registered by BeforeSuite still run
+		"AfterSuite: torn down",
+		"AfterSuite: cleaned up",
+	}, lines)
+}
+
+func TestRunAsTestEachHooks(t *testing.T) {
+	if helperProcess() {
+		var s Suite
+		require.NoError(t, s.RegisterTest("p", "a", func(t TestingT) {
+			t.Run("sub", logsName)
+			t.Run("bad", logsName)
+		}))
+		require.NoError(t, s.RegisterPackageHook("p", HookBeforeEach, func(t TestingT) {
+			t.Log("before", t.Name())
+			if strings.HasSuffix(t.Name(), "/bad") {
+				t.Errorf("BeforeEach failed")
+			}
+		}))
+		require.NoError(t, s.RegisterPackageHook("p", HookAfterEach, func(t TestingT) {
+			t.Log("after", t.Name())
+		}))
+		s.RunAsTest(t)
+		return
 	}
+
+	lines, failed := loggedLines(t, t.Name())
+	assert.True(t, failed)
+	assert.Equal(t, []string{
+		"before a/sub",
+		"ran a/sub",
+		"after a/sub",
+		"before a/bad",
+		"BeforeEach failed",
+		// the subtest is not run if BeforeEach fails, but AfterEach is
+		"after a/bad",
+	}, lines)
+}
+
+func TestRunAsTestShuffleSeed(t *testing.T) {
+	if helperProcess() {
+		var s Suite
+		for _, pkg := range []string{"p", "q", "r"} {
+			for _, name := range []string{"a", "b", "c"} {
+				require.NoError(t, s.RegisterTest(pkg, pkg+"-"+name, logsName))
+			}
+		}
+		s.RunAsTest(t)
+		return
+	}
+
+	lines, failed := loggedLines(t, t.Name(), "-test.shuffle=on")
+	assert.False(t, failed)
+	require.Len(t, lines, 10)
+	seed, ok := strings.CutPrefix(lines[0], "testy: -test.shuffle ")
+	require.True(t, ok, lines[0])
+
+	replayed, failed := loggedLines(t, t.Name(), "-test.shuffle="+seed)
+	assert.False(t, failed)
+	assert.Equal(t, lines[1:], replayed, "the logged seed replays the same order")
 }
@@ -0,0 +1,128 @@
+package testy
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventKind indicates what happened to cause an Event.
+type EventKind string
+
+const (
+	// EventPackageStarted is sent when a package has started running, before its BeforePackage is run.
+	EventPackageStarted EventKind = "package started"
+	// EventTestStarted is sent when a test or subtest has started running.
+	EventTestStarted EventKind = "test started"
+	// EventMsg is sent when a test or subtest emits a message.
+	EventMsg EventKind = "msg"
+	// EventTestRetried is sent when an attempt at running a registered test failed and the test is about to be run again.
+	// Result is the result of the attempt that failed. See RunOptions.Retries.
+	EventTestRetried EventKind = "test retried"
+	// EventTestFinished is sent when a test or subtest has finished running, including all of its subtests.
+	// For a test that was retried, it is only sent once its last attempt has finished.
+	EventTestFinished EventKind = "test finished"
+	// EventPackageFinished is sent when a package has finished running, after its AfterPackage is run.
+	EventPackageFinished EventKind = "package finished"
+	// EventSuiteFinished is sent when every package has finished running. It is always the last event sent.
+	EventSuiteFinished EventKind = "suite finished"
+)
+
+// Event describes the progress of a test run started by Stream.
+type Event struct {
+	// Kind is what happened.
+	Kind EventKind
+	// Time is when the event happened.
+	Time time.Time
+	// Package is the package the event is for. It is empty for EventSuiteFinished.
+	Package string
+	// Name is the full name of the test or subtest the event is for, with each level separated by a slash.
+	// It is empty for package and suite events.
+	Name string
+	// Msg is the message that was emitted. It is only set for EventMsg.
+	Msg *Msg
+	// Result is the result of the test, package, or whole suite that finished.
+	// It is only set for the finished events, and for EventTestRetried.
+	// For EventSuiteFinished, it is the same result that RunWithOptions would have returned.
+	Result *TestResult
+}
+
+// Stream runs the registered tests selected by opts in the background and returns a channel of events describing their progress.
+// It is equivalent to StreamContext with context.Background.
+// This allows results to be displayed while the tests are still running.
+// The last event sent is always EventSuiteFinished, after which the channel is closed.
+//
+// The channel must be read until it is closed, otherwise the tests will be blocked from making progress.
+// When packages or tests are run concurrently, events for them are interleaved.
+//
+// An error is returned if opts is invalid, in which case no tests are run.
+func Stream(opts RunOptions) (<-chan Event, error) {
+	return instance.Stream(opts)
+}
+
+// Stream is like the package-level Stream, but runs the tests registered with s.
+func (s *Suite) Stream(opts RunOptions) (<-chan Event, error) {
+	return s.StreamContext(context.Background(), opts)
+}
+
+// StreamContext is like Stream, but stops running tests once ctx is done.
+// Tests that are running when ctx is done are not interrupted, but can observe it via TestingT.Context.
+// Tests that had not started yet are reported as ResultCancelled, and the last event is still EventSuiteFinished.
+func StreamContext(ctx context.Context, opts RunOptions) (<-chan Event, error) {
+	return instance.StreamContext(ctx, opts)
+}
+
+// StreamContext is like the package-level StreamContext, but runs the tests registered with s.
+func (s *Suite) StreamContext(ctx context.Context, opts RunOptions) (<-chan Event, error) {
+	cfg, err := opts.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	events := &eventStream{ch: make(chan Event, 64)}
+	cfg.events = events
+	go func() {
+		defer events.close()
+		s.runSuite(ctx, cfg)
+	}()
+	return events.ch, nil
+}
+
+// eventStream is a channel of events that may be safely sent to after it has been closed.
+// This is needed since tests that timed out are left running in the background after the run has finished.
+type eventStream struct {
+	mu     sync.RWMutex
+	closed bool
+	ch     chan Event
+}
+
+func (es *eventStream) send(ev Event) {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	if !es.closed {
+		es.ch <- ev
+	}
+}
+
+func (es *eventStream) close() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.closed = true
+	close(es.ch)
+}
+
+// emit sends ev to the consumer of the run, if there is one.
+// Since every test reports that it has finished through here, this is also where failures are counted for FailFast.
+func (cfg *runConfig) emit(ev Event) {
+	// registered tests are the only ones without a slash in their name
+	if ev.Kind == EventTestFinished && cfg.failures != nil && !strings.Contains(ev.Name, "/") && ev.Result.Result == ResultFailed {
+		cfg.failures.Add(1)
+	}
+
+	if cfg.events == nil {
+		return
+	}
+	ev.Time = time.Now()
+	cfg.events.send(ev)
+}
@@ -1,97 +1,810 @@
 package testy
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
 type t struct {
-	name        string
-	tester      Tester
-	failed      bool
-	msgs        []Msg
-	subtests    chan<- subtest
-	subtestDone <-chan bool
-}
-
-type subtest struct {
 	name   string
+	pkg    string
 	tester Tester
+	// pkgTests is the package being run, for its BeforeEach and AfterEach. It is nil for Before/After helpers.
+	pkgTests *testPkg
+	cfg      *runConfig
+	// parallelSem limits how many parallel tests may run at the same time. It is shared by every test in a package.
+	parallelSem chan struct{}
+	parent      *t
+	// timeout is how long the test may run for before it is abandoned. Zero means no timeout.
+	timeout time.Duration
+	// metadata describes the registered test. It is nil for subtests.
+	metadata *Metadata
+	// attempt is which attempt at running a registered test that may be retried this is, starting at 1.
+	// It is zero for tests that are not retried. Only the first attempt reports that it started,
+	// and none of them report that they finished, since runChildWithRetries does that once the last one has.
+	attempt int
+	// runName is the name of the test as matched by RunOptions.Run, which leaves out the iterations of repeated tests.
+	runName string
+	// iteration is set if the test is one of the iterations of a test that is run RunOptions.Count times.
+	iteration bool
+	// captureLog is set if the output of the standard logger is added to the test's messages, per RunOptions.CaptureLog.
+	captureLog bool
+	// ctx is cancelled once the test has finished or timed out.
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mu               sync.Mutex
+	start            time.Time
+	goroutine        int64
+	failed           bool
+	skipped          bool
+	msgs             []Msg
+	isParallel       bool
+	holdsSlot        bool
+	subtests         []*t
+	parallelSubtests []*t
+	finished         bool
+	timedOut         bool
+	cleanups         []func()
+	hooks            []TestResult
+	// deadline is when the test will time out, if it has a timeout and is not paused in Parallel.
+	deadline time.Time
+	// setenv is set once the test has called Setenv, after which it may not call Parallel.
+	setenv bool
+	// repeated is set if the test's subtests are its iterations, so its result summarizes them.
+	repeated bool
+	// parallelIterations makes a repeated test parallel the first time one of its iterations calls Parallel.
+	parallelIterations sync.Once
+	// helpers are the names of the functions that called Helper, which are skipped when finding where a message is from.
+	helpers map[string]struct{}
+
+	// paused is closed when the test calls Parallel and is waiting for its parent's function to return.
+	paused chan struct{}
+	// resumed is closed when the test has finished waiting in Parallel and continues running.
+	resumed chan struct{}
+	// barrier is closed when the test's function returns, which releases its parallel subtests.
+	barrier chan struct{}
+	// done is closed when the test and all of its subtests have finished. result is valid once done is closed.
+	done   chan struct{}
+	result TestResult
 }
 
 var _ TestingT = (*t)(nil)
 
+// newRootT creates a t that is not a test itself, but acts as the parent of the top level tests in a package.
+func newRootT(ctx context.Context, pkgTests *testPkg, cfg *runConfig) *t {
+	return &t{
+		ctx:         ctx,
+		pkg:         pkgTests.name,
+		pkgTests:    pkgTests,
+		cfg:         cfg,
+		captureLog:  cfg.captureLog,
+		parallelSem: make(chan struct{}, cfg.parallel),
+		barrier:     make(chan struct{}),
+	}
+}
+
+// newHelperT creates a t for running Before/After functions, which are not tests themselves.
+// name is the name of the test the function is run for, if any.
+func newHelperT(ctx context.Context, pkg, name string) *t {
+	return &t{ctx: ctx, pkg: pkg, name: name}
+}
+
 // test returns whether this t is actually being used in a test. This is determined by the tester func being non-nil.
 func (t *t) test() bool {
 	return t.tester != nil
 }
 
+// runChild starts tester as a subtest of t and waits for it to finish, time out, or call Parallel.
+// name must already be sanitized. timeout and metadata are only set for registered tests.
+func (t *t) runChild(name string, tester Tester, timeout time.Duration, metadata *Metadata) *t {
+	child := newChildT(t, name, tester)
+	child.timeout = timeout
+	child.metadata = metadata
+	t.startChild(child)
+
+	select {
+	case <-child.paused:
+	case <-child.done:
+	}
+	return child
+}
+
+// startChild adds child as a subtest of t and starts running it, without waiting for it.
+func (t *t) startChild(child *t) {
+	t.mu.Lock()
+	t.subtests = append(t.subtests, child)
+	t.mu.Unlock()
+
+	// run in another goroutine so FailNow can work
+	go child.run()
+}
+
+// newIterationT creates the i-th iteration of t, which is a repeated test, as a subtest of t that is not started yet.
+// Its name is the iteration number, padded to width digits so that the iterations sort in order.
+func newIterationT(t *t, i, width int, tester Tester, timeout time.Duration) *t {
+	child := newChildT(t, fmt.Sprintf("#%0*d", width, i), tester)
+	child.runName = t.runName
+	child.iteration = true
+	child.timeout = timeout
+	return child
+}
+
+// runChildWithRetries is like runChild, but runs tester again as a new attempt, up to retries more times,
+// for as long as it fails. It waits for the first attempt to finish, time out, or call Parallel,
+// or for every attempt to finish if none of them call Parallel.
+// The returned subtest is a placeholder for all of the attempts, which is done once the last one is.
+func (t *t) runChildWithRetries(name string, tester Tester, timeout time.Duration, metadata *Metadata, retries int) *t {
+	child := newChildT(t, name, nil)
+	child.metadata = metadata
+
+	t.mu.Lock()
+	t.subtests = append(t.subtests, child)
+	t.mu.Unlock()
+
+	go func() {
+		var attempts []TestResult
+		paused := false
+		for {
+			attempt := newChildT(t, name, tester)
+			attempt.timeout = timeout
+			attempt.metadata = metadata
+			attempt.attempt = len(attempts) + 1
+			go attempt.run()
+
+			select {
+			case <-attempt.paused:
+				// let t continue, like runChild does; any further attempts are run in the background
+				if !paused {
+					paused = true
+					close(child.paused)
+				}
+				<-attempt.done
+			case <-attempt.done:
+			}
+
+			res := attempt.result
+			if res.Result != ResultFailed || len(attempts) >= retries || t.cfg.stopped(t.ctx) != nil {
+				if len(attempts) > 0 {
+					res.Attempts = attempts
+					if res.Result == ResultPassed {
+						res.Result = ResultFlaky
+					}
+				}
+				child.mu.Lock()
+				child.finished = true
+				child.result = res
+				child.mu.Unlock()
+
+				t.emit(Event{Kind: EventTestFinished, Package: child.pkg, Name: child.name, Result: &res})
+				close(child.done)
+				return
+			}
+
+			attempts = append(attempts, res)
+			t.emit(Event{Kind: EventTestRetried, Package: child.pkg, Name: child.name, Result: &res})
+		}
+	}()
+
+	select {
+	case <-child.paused:
+	case <-child.done:
+	}
+	return child
+}
+
+// cancelChild records a subtest of t that was not run because err stopped the run.
+// name must already be sanitized. metadata is only set for registered tests.
+func (t *t) cancelChild(name string, err error, metadata *Metadata) {
+	child := newChildT(t, name, nil)
+	child.cancel(nil)
+	child.finished = true
+	child.result = cancelledResult(child.pkg, child.name, err)
+	child.result.Metadata = metadata
+	close(child.done)
+
+	t.mu.Lock()
+	t.subtests = append(t.subtests, child)
+	t.mu.Unlock()
+
+	res := child.result
+	t.emit(Event{Kind: EventTestFinished, Package: child.pkg, Name: child.name, Result: &res})
+}
+
+func newChildT(parent *t, name string, tester Tester) *t {
+	runName := name
+	if parent.name != "" {
+		name = parent.name + "/" + name
+		runName = parent.runName + "/" + runName
+	}
+	ctx, cancel := context.WithCancelCause(parent.ctx)
+	return &t{
+		ctx:         ctx,
+		cancel:      cancel,
+		name:        name,
+		runName:     runName,
+		pkg:         parent.pkg,
+		pkgTests:    parent.pkgTests,
+		tester:      tester,
+		cfg:         parent.cfg,
+		captureLog:  parent.captureLog,
+		parallelSem: parent.parallelSem,
+		parent:      parent,
+		paused:      make(chan struct{}),
+		resumed:     make(chan struct{}),
+		barrier:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
 func (t *t) run() {
+	t.mu.Lock()
+	t.start = time.Now()
+	t.goroutine = goroutineID()
+	if t.timeout > 0 {
+		t.deadline = t.start.Add(t.timeout)
+	}
+	t.mu.Unlock()
+
+	if t.captureLog {
+		// deferred first so that output from cleanup functions is captured as well
+		logCapture.add(t)
+		defer logCapture.remove(t)
+	}
+
+	if t.attempt <= 1 {
+		t.emit(Event{Kind: EventTestStarted, Package: t.pkg, Name: t.name})
+	}
+	if t.timeout > 0 {
+		go t.watch()
+	}
+
 	defer func() {
 		// catch panics and mark test as failed
 		if err := recover(); err != nil {
-			// not using Fatalf since we're already in the defer that would get run and we need to clean up the channel
 			t.Errorf("panic: %+v", err)
-			t.Fail()
 		}
-		close(t.subtests)
+		t.waitParallel()
+		t.cancel(nil)
+		// make sure the test is finished even if a cleanup function calls FailNow or SkipNow
+		defer func() {
+			t.releaseSlot()
+			t.finish()
+		}()
+		t.runCleanups()
 	}()
 
 	t.tester(t)
 }
 
+// waitParallel releases the parallel subtests of t, which must only be done once t's function has returned,
+// and then waits for all of them to finish.
+func (t *t) waitParallel() {
+	close(t.barrier)
+
+	t.mu.Lock()
+	parallel := t.parallelSubtests
+	t.mu.Unlock()
+	if len(parallel) == 0 {
+		return
+	}
+
+	// give up our own slot while waiting, otherwise deeply nested parallel tests could deadlock
+	held := t.releaseSlot()
+	for _, st := range parallel {
+		<-st.done
+	}
+	if held {
+		t.acquireSlot()
+	}
+}
+
+// runCleanups calls the functions registered with Cleanup in last added, first called order.
+// A panicking cleanup function marks the test as failed and the remaining ones are still called.
+func (t *t) runCleanups() {
+	// keep going if a cleanup function calls FailNow or SkipNow
+	defer func() {
+		t.mu.Lock()
+		more := len(t.cleanups) > 0
+		t.mu.Unlock()
+		if more {
+			t.runCleanups()
+		}
+	}()
+
+	for {
+		t.mu.Lock()
+		if len(t.cleanups) == 0 {
+			t.mu.Unlock()
+			return
+		}
+		f := t.cleanups[len(t.cleanups)-1]
+		t.cleanups = t.cleanups[:len(t.cleanups)-1]
+		t.mu.Unlock()
+
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					t.Errorf("panic in cleanup: %+v", err)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+// acquireSlot waits until the test may run in parallel with other tests.
+func (t *t) acquireSlot() {
+	t.parallelSem <- struct{}{}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.holdsSlot = true
+}
+
+// releaseSlot allows another parallel test to run, if the test was holding a slot.
+// It reports whether the test was holding a slot.
+func (t *t) releaseSlot() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.holdsSlot {
+		return false
+	}
+	t.holdsSlot = false
+	<-t.parallelSem
+	return true
+}
+
+// finish records the result of the test, which includes the results of all of its subtests.
+// If the test has already timed out, its result has already been recorded so this does nothing.
+func (t *t) finish() {
+	t.mu.Lock()
+	if t.timedOut {
+		t.mu.Unlock()
+		return
+	}
+	t.finished = true
+
+	dur := time.Since(t.start).Round(time.Millisecond)
+	r := ResultPassed
+	if t.failed {
+		r = ResultFailed
+	} else if t.skipped {
+		r = ResultSkipped
+	}
+	var subtests []TestResult
+	for _, st := range t.subtests {
+		r = worstResult(r, st.result.Result)
+		subtests = append(subtests, st.result)
+	}
+
+	t.result = TestResult{
+		Package:  t.pkg,
+		Name:     t.name,
+		Msgs:     t.msgs,
+		Result:   r,
+		Started:  t.start,
+		Dur:      dur,
+		DurHuman: dur.String(),
+		Subtests: subtests,
+		Metadata: t.metadata,
+		Hooks:    t.hooks,
+	}
+	if t.repeated {
+		t.result.Iterations = newIterationStats(subtests)
+	}
+	res := t.result
+	t.mu.Unlock()
+
+	if t.attempt == 0 {
+		t.emit(Event{Kind: EventTestFinished, Package: t.pkg, Name: t.name, Result: &res})
+	}
+	close(t.done)
+}
+
+// addMsgs appends messages to the test's output.
+func (t *t) addMsgs(msgs ...Msg) {
+	t.mu.Lock()
+	t.msgs = append(t.msgs, msgs...)
+	t.mu.Unlock()
+
+	for i := range msgs {
+		t.emit(Event{Kind: EventMsg, Package: t.pkg, Name: t.name, Msg: &msgs[i]})
+	}
+}
+
+// addHook records the result of a Before/After function that was run for the test.
+func (t *t) addHook(res TestResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks = append(t.hooks, res)
+}
+
+// msgsFrom returns a copy of the test's messages, starting at index i.
+func (t *t) msgsFrom(i int) []Msg {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Msg(nil), t.msgs[i:]...)
+}
+
+// emit sends ev to the consumer of the run, unless the test has been abandoned because it timed out.
+// The consumer has already been told that an abandoned test finished.
+func (t *t) emit(ev Event) {
+	// Before/After helpers aren't tests so there's nothing to report against
+	if t.cfg == nil || t.abandoned() {
+		return
+	}
+	t.cfg.emit(ev)
+}
+
+// abandoned reports whether the test or any of its parents timed out.
+func (t *t) abandoned() bool {
+	for ; t != nil; t = t.parent {
+		t.mu.Lock()
+		timedOut := t.timedOut
+		t.mu.Unlock()
+		if timedOut {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *t) Fail() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.failed = true
 }
 
 func (t *t) FailNow() {
 	t.Fail()
-	if t.test() {
-		runtime.Goexit()
-	} else {
-		panic("before/after helper t failed")
+	// Before/After helpers are run in their own goroutine too, so this is fine for them as well
+	runtime.Goexit()
+}
+
+func (t *t) Failed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed {
+		return true
+	}
+	// like go test, a failing subtest also fails its parent
+	for _, st := range t.subtests {
+		select {
+		case <-st.done:
+			if st.result.Result == ResultFailed {
+				return true
+			}
+		default:
+			if st.Failed() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t *t) Name() string {
+	return t.name
+}
+
+func (t *t) Deadline() (deadline time.Time, ok bool) {
+	deadline, ok = t.Context().Deadline()
+	// subtests are limited by the timeout of the registered test they are part of
+	for p := t; p != nil; p = p.parent {
+		p.mu.Lock()
+		d := p.deadline
+		p.mu.Unlock()
+		if !d.IsZero() && (!ok || d.Before(deadline)) {
+			deadline, ok = d, true
+		}
 	}
+	return deadline, ok
 }
 
 func (t *t) Fatal(args ...interface{}) {
-	t.msgs = append(t.msgs, Msg{Msg: fmt.Sprintln(args...), Level: LevelError})
+	t.log(LevelError, fmt.Sprintln(args...))
 	t.FailNow()
 }
 
 func (t *t) Fatalf(format string, args ...interface{}) {
-	t.msgs = append(t.msgs, Msg{Msg: fmt.Sprintf(format, args...), Level: LevelError})
+	t.log(LevelError, fmt.Sprintf(format, args...))
 	t.FailNow()
 }
 
 func (t *t) Errorf(format string, args ...interface{}) {
-	t.msgs = append(t.msgs, Msg{Msg: fmt.Sprintf(format, args...), Level: LevelError})
-	t.failed = true
+	t.log(LevelError, fmt.Sprintf(format, args...))
+	t.Fail()
+}
+
+func (t *t) Skip(args ...interface{}) {
+	t.log(LevelInfo, fmt.Sprintln(args...))
+	t.SkipNow()
+}
+
+func (t *t) Skipf(format string, args ...interface{}) {
+	t.log(LevelInfo, fmt.Sprintf(format, args...))
+	t.SkipNow()
+}
+
+func (t *t) SkipNow() {
+	t.mu.Lock()
+	t.skipped = true
+	t.mu.Unlock()
+	runtime.Goexit()
+}
+
+func (t *t) Skipped() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.skipped
 }
 
 func (t *t) Helper() {
-	// nothing to do here, I think?
+	var pc [1]uintptr
+	// skip over Callers and ourselves
+	if runtime.Callers(2, pc[:]) == 0 {
+		return
+	}
+	frame, _ := runtime.CallersFrames(pc[:]).Next()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.helpers == nil {
+		t.helpers = make(map[string]struct{})
+	}
+	t.helpers[frame.Function] = struct{}{}
 }
 
 func (t *t) Log(args ...interface{}) {
-	t.msgs = append(t.msgs, Msg{Msg: fmt.Sprintln(args...), Level: LevelInfo})
+	t.log(LevelInfo, fmt.Sprintln(args...))
 }
 
 func (t *t) Logf(format string, args ...interface{}) {
-	t.msgs = append(t.msgs, Msg{Msg: fmt.Sprintf(format, args...), Level: LevelInfo})
+	t.log(LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (t *t) Output() io.Writer {
+	w := &lineWriter{log: func(line string) {
+		t.log(LevelInfo, line)
+	}}
+	t.Cleanup(w.flush)
+	return w
+}
+
+func (t *t) Logger() *slog.Logger {
+	return slog.New(&msgHandler{t: t})
+}
+
+// log adds a message to the test's output, recording when and where it was emitted.
+func (t *t) log(level Level, msg string, attrs ...Attr) {
+	m := Msg{Msg: msg, Level: level, Attrs: attrs}
+	m.File, m.Line = t.caller()
+
+	t.mu.Lock()
+	if !t.start.IsZero() {
+		m.Offset = time.Since(t.start)
+	}
+	t.mu.Unlock()
+
+	t.addMsgs(m)
+}
+
+// caller finds the file and line in the test's code that a message was emitted from.
+// The frames of this package (other than its tests), of the runtime and logging packages,
+// and of functions that called Helper are skipped,
+// so that messages from a panic point at where it was raised.
+// If every frame of the test's code is in a helper, the outermost one is used, which is usually the test function.
+func (t *t) caller() (string, int) {
+	var pc [64]uintptr
+	// skip over Callers and ourselves
+	n := runtime.Callers(2, pc[:])
+	frames := runtime.CallersFrames(pc[:n])
+
+	var outermost runtime.Frame
+	for {
+		frame, more := frames.Next()
+		if !internalFrame(frame) {
+			if !t.isHelper(frame.Function) {
+				return frame.File, frame.Line
+			}
+			outermost = frame
+		}
+		if !more {
+			return outermost.File, outermost.Line
+		}
+	}
+}
+
+// isHelper reports whether the named function called Helper on t or any of its parents.
+func (t *t) isHelper(function string) bool {
+	for tt := t; tt != nil; tt = tt.parent {
+		tt.mu.Lock()
+		_, ok := tt.helpers[function]
+		tt.mu.Unlock()
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// thisPackage is the import path of this package.
+var thisPackage = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	return packageAndFuncNameToPackage(runtime.FuncForPC(pc).Name())
+}()
+
+// internalFrame reports whether frame is part of running tests rather than a test itself.
+func internalFrame(frame runtime.Frame) bool {
+	for _, pkg := range []string{"runtime.", "log.", "log/slog."} {
+		if strings.HasPrefix(frame.Function, pkg) {
+			return true
+		}
+	}
+	return strings.HasPrefix(frame.Function, thisPackage+".") && !strings.HasSuffix(frame.File, "_test.go")
 }
 
 func (t *t) Run(name string, tester Tester) bool {
 	if !t.test() {
 		panic("attempting to run subtest on non-subtest-capable T (you can only Run in Tests, not Before/After)")
 	}
-	t.subtests <- subtest{
-		name:   strings.Map(sanitizeName, name),
-		tester: tester,
+	name = strings.Map(sanitizeName, name)
+	if ok, _ := t.cfg.run.matches(t.runName + "/" + name); !ok {
+		// like go test, subtests that are filtered out are treated as if they passed
+		return true
+	}
+
+	// don't start any more subtests once we've been cancelled
+	if err := t.ctx.Err(); err != nil {
+		t.cancelChild(name, err, nil)
+		return false
+	}
+
+	child := t.runChild(name, subtestWithHooks(t.pkgTests, tester), 0, nil)
+	select {
+	case <-child.done:
+		return child.result.Result == ResultPassed || child.result.Result == ResultSkipped
+	default:
+		// the subtest called Parallel, so it has only reported whether it failed before doing so
+		return !child.Failed()
+	}
+}
+
+// Parallel pauses the test until its parent's function has returned,
+// and then runs it alongside the other parallel subtests of its parent.
+// At most RunOptions.Parallel tests in a package will run in parallel at the same time.
+func (t *t) Parallel() {
+	if !t.test() || t.parent == nil {
+		// Before/After helpers can't be parallel
+		return
+	}
+
+	t.mu.Lock()
+	if t.isParallel {
+		t.mu.Unlock()
+		panic("testy: t.Parallel called multiple times")
+	}
+	if t.setenv {
+		t.mu.Unlock()
+		panic("testy: t.Parallel called after t.Setenv; cannot set environment variables in parallel tests")
+	}
+	t.isParallel = true
+	t.mu.Unlock()
+
+	if t.iteration {
+		t.parallelIteration()
+		return
+	}
+
+	t.parent.mu.Lock()
+	t.parent.parallelSubtests = append(t.parent.parallelSubtests, t)
+	t.parent.mu.Unlock()
+
+	// let the parent continue, then wait for it to finish running its function
+	t.mu.Lock()
+	t.deadline = time.Time{}
+	t.mu.Unlock()
+	close(t.paused)
+	<-t.parent.barrier
+	t.acquireSlot()
+	if t.timeout > 0 {
+		// the watchdog restarts its timer once we're resumed
+		t.mu.Lock()
+		t.deadline = time.Now().Add(t.timeout)
+		t.mu.Unlock()
+	}
+	close(t.resumed)
+}
+
+// parallelIteration makes the repeated test that t is an iteration of parallel with the other tests of its package,
+// instead of making t parallel with the other iterations, which would ignore RunOptions.CountConcurrency.
+// The iterations that call Parallel wait for the repeated test to resume, and then carry on as before.
+func (t *t) parallelIteration() {
+	t.mu.Lock()
+	t.deadline = time.Time{}
+	t.mu.Unlock()
+	close(t.paused)
+	t.parent.parallelIterations.Do(t.parent.Parallel)
+	if t.timeout > 0 {
+		t.mu.Lock()
+		t.deadline = time.Now().Add(t.timeout)
+		t.mu.Unlock()
+	}
+	close(t.resumed)
+}
+
+func (t *t) Cleanup(f func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cleanups = append(t.cleanups, f)
+}
+
+// TempDir creates a new directory for each call, which is removed once the test and all of its subtests have finished.
+func (t *t) TempDir() string {
+	pattern := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, t.name)
+	if len(pattern) > 64 {
+		pattern = pattern[:64]
+	}
+
+	dir, err := os.MkdirTemp("", pattern+"-")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
 	}
-	return <-t.subtestDone
+	t.Cleanup(func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Errorf("TempDir RemoveAll cleanup: %v", err)
+		}
+	})
+	return dir
 }
 
-// Parallel does nothing for this implementation.
-// TODO figure out how to support it.
-func (*t) Parallel() {}
+// Setenv sets an environment variable and restores its previous value once the test has finished.
+// Since the environment is shared by the whole process, it panics if the test or any of its parents are parallel.
+func (t *t) Setenv(key, value string) {
+	for p := t; p != nil; p = p.parent {
+		p.mu.Lock()
+		isParallel := p.isParallel
+		p.mu.Unlock()
+		if isParallel {
+			panic("testy: t.Setenv called after t.Parallel; cannot set environment variables in parallel tests")
+		}
+	}
+	t.mu.Lock()
+	t.setenv = true
+	t.mu.Unlock()
+
+	prev, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatalf("cannot set environment variable: %v", err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, prev)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+// Context returns a context that is cancelled once the test and all of its subtests have finished,
+// once the test has timed out, or once the run was cancelled.
+func (t *t) Context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
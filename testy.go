@@ -1,14 +1,32 @@
 package testy
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/gametimesf/testy/internal/orderedmap"
 )
 
-type testy struct {
-	tests orderedmap.OrderedMap[string, *testPkg]
-	db    DB
+// Suite is a set of registered tests, along with their Before/After functions, profiles and result datastore.
+// Each Suite is run and configured independently of any other, so a single binary can have several of them,
+// such as one per API it tests.
+//
+// The package-level functions, such as Test, Run, SetDB and AddEchoRoutes, use a default Suite.
+// The zero value is an empty Suite ready to use.
+type Suite struct {
+	// mu guards everything that is registered, but not db, which is only set during application startup.
+	mu          sync.RWMutex
+	tests       orderedmap.OrderedMap[string, *testPkg]
+	db          DB
+	beforeSuite Tester
+	afterSuite  Tester
+	profiles    map[string]RunOptions
 }
 
 type testPkg struct {
@@ -18,12 +36,45 @@ type testPkg struct {
 	AfterPackage  Tester
 	BeforeTest    Tester
 	AfterTest     Tester
+	BeforeEach    Tester
+	AfterEach     Tester
+	timeout       time.Duration
+	retries       int
 }
 
 type testCase struct {
-	Package string
-	Name    string
-	tester  Tester
+	Package  string
+	Name     string
+	tester   Tester
+	timeout  time.Duration
+	retries  int
+	metadata Metadata
+}
+
+// Metadata describes a registered test. It is set using the TestOption values passed to Test.
+type Metadata struct {
+	// Tags are set by the Tags option.
+	Tags []string `json:",omitempty"`
+	// Owner is set by the Owner option.
+	Owner string `json:",omitempty"`
+	// Description is set by the Description option.
+	Description string `json:",omitempty"`
+	// Runbook is set by the Runbook option.
+	Runbook string `json:",omitempty"`
+}
+
+// HasTag reports whether the test has the provided tag.
+func (m Metadata) HasTag(tag string) bool {
+	return slices.Contains(m.Tags, tag)
+}
+
+// resultMetadata returns the test's metadata, or nil if none was set, so that it is omitted from results.
+func (tc testCase) resultMetadata() *Metadata {
+	m := tc.metadata
+	if len(m.Tags) == 0 && m.Owner == "" && m.Description == "" && m.Runbook == "" {
+		return nil
+	}
+	return &m
 }
 
 // Tester is a thing that runs a test.
@@ -48,14 +99,92 @@ type TestResult struct {
 	DurHuman string
 	// Subtests contains the test result of every test this test started via Run or TestEach.
 	Subtests []TestResult
+	// Metadata describes the registered test, if any options setting it were passed to Test.
+	// It is only set on the results of registered tests, not on subtests.
+	Metadata *Metadata `json:",omitempty"`
+	// Hooks contains the result of each Before/After function that was run for this test, in the order they were run.
+	// BeforeSuite and AfterSuite are attached to the top level result, BeforePackage and AfterPackage to the package's result,
+	// and BeforeTest and AfterTest to the result of the registered test they were run for.
+	// The Name of each is the kind of function, such as "BeforePackage", and it never has any subtests.
+	// It is only set when using Run.
+	Hooks []TestResult `json:",omitempty"`
+	// Shuffle is the seed that was used to shuffle the execution order of the tests, if it was shuffled.
+	// Pass it as RunOptions.Shuffle to run the tests in the same order again.
+	// It is only set on the top level result returned by Run.
+	Shuffle string `json:",omitempty"`
+	// Profile is the name of the profile that was run, if the options came from ProfileOptions.
+	// It is only set on the top level result returned by Run.
+	Profile string `json:",omitempty"`
+	// Attempts contains the result of each earlier attempt at running a registered test that failed and was retried,
+	// in the order they were run. The rest of the test's result is that of its last attempt.
+	// It is only set when using Run with retries; see RunOptions.Retries.
+	Attempts []TestResult `json:",omitempty"`
+	// Iterations summarizes the subtests of a registered test that was run more than once with RunOptions.Count,
+	// each of which is one iteration of the test.
+	Iterations *IterationStats `json:",omitempty"`
+}
+
+// IterationStats summarizes the iterations of a registered test that was run more than once with RunOptions.Count.
+// Iterations that were not run because the run was cancelled are left out.
+type IterationStats struct {
+	// Count is the number of iterations that were run.
+	Count  int
+	Passed int
+	Failed int
+	// PassRate is the percentage of iterations that passed, from 0 to 100.
+	PassRate float64
+	// Min, Median, P95 and Max are percentiles of how long the iterations took, using the nearest-rank method.
+	Min    time.Duration
+	Median time.Duration
+	P95    time.Duration
+	Max    time.Duration
+}
+
+// newIterationStats summarizes the results of the iterations of a repeated test.
+func newIterationStats(iterations []TestResult) *IterationStats {
+	var stats IterationStats
+	var durs []time.Duration
+	for _, it := range iterations {
+		switch it.Result {
+		case ResultCancelled:
+			continue
+		case ResultPassed:
+			stats.Passed++
+		case ResultFailed:
+			stats.Failed++
+		}
+		stats.Count++
+		durs = append(durs, it.Dur)
+	}
+	if stats.Count == 0 {
+		return &stats
+	}
+
+	stats.PassRate = float64(stats.Passed) * 100 / float64(stats.Count)
+	slices.Sort(durs)
+	percentile := func(p int) time.Duration {
+		// the smallest duration that at least p percent of the iterations took no longer than
+		rank := (p*len(durs) + 99) / 100
+		return durs[max(rank, 1)-1]
+	}
+	stats.Min = durs[0]
+	stats.Median = percentile(50)
+	stats.P95 = percentile(95)
+	stats.Max = durs[len(durs)-1]
+	return &stats
 }
 
 // Level indicates at what log level a Msg was emitted.
 type Level string
 
 const (
+	// LevelDebug is a debugging log message, such as a request dump, which is only emitted via TestingT.Logger.
+	// The HTML report hides these messages unless asked to show them.
+	LevelDebug Level = "debug"
 	// LevelInfo is an informative log message (Log, etc.)
 	LevelInfo Level = "info"
+	// LevelWarn is a warning log message, which is only emitted via TestingT.Logger.
+	LevelWarn Level = "warn"
 	// LevelError is an error log message (Fatal, etc.)
 	LevelError Level = "error"
 )
@@ -68,18 +197,69 @@ const (
 	ResultPassed Result = "passed"
 	// ResultFailed indicates that this test or at least one of its subtests failed.
 	ResultFailed Result = "failed"
+	// ResultCancelled indicates that this test or at least one of its subtests was not run because the run was cancelled,
+	// and that none of them failed.
+	ResultCancelled Result = "cancelled"
+	// ResultSkipped indicates that this test called TestingT.Skip (or a similar method) and did not fail before doing so.
+	// A test is not marked as skipped just because some or all of its subtests were.
+	ResultSkipped Result = "skipped"
+	// ResultFlaky indicates that this registered test failed, but passed when it was retried,
+	// or that at least one of its subtests is flaky and that none of them failed or were cancelled.
+	ResultFlaky Result = "flaky"
 )
 
+// resultSeverity orders results so that the result of a test can be determined from its own result and its subtests'.
+var resultSeverity = map[Result]int{
+	ResultSkipped:   0,
+	ResultPassed:    0,
+	ResultFlaky:     1,
+	ResultCancelled: 2,
+	ResultFailed:    3,
+}
+
+// worstResult returns whichever of a and b is the most severe.
+func worstResult(a, b Result) Result {
+	if resultSeverity[b] > resultSeverity[a] {
+		return b
+	}
+	return a
+}
+
 type Msg struct {
 	Msg   string
 	Level Level
+	// Offset is how long after the test started that the message was emitted.
+	Offset time.Duration `json:",omitempty"`
+	// File and Line are where in the test's code the message was emitted,
+	// skipping over functions that called TestingT.Helper.
+	// They are not set for messages that are added by this package, such as those for timeouts.
+	File string `json:",omitempty"`
+	Line int    `json:",omitempty"`
+	// Attrs are the key/value attributes of a message emitted via TestingT.Logger, in the order they were given.
+	Attrs []Attr `json:",omitempty"`
 }
 
-var instance testy
+// Attr is a key/value attribute of a Msg.
+// Attributes in slog groups have keys qualified by the group names, such as "request.method".
+type Attr struct {
+	Key   string
+	Value string
+}
+
+// Location returns the base name of File and Line, such as "api_test.go:42", or an empty string if File is not set.
+func (m Msg) Location() string {
+	if m.File == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", filepath.Base(m.File), m.Line)
+}
+
+// instance is the default Suite used by the package-level functions.
+var instance = &Suite{}
 
 // TestingT is a subset of testing.T that we have to implement for non-`go test` runs.
 //
-// TODO flesh this out with more useful stuff from testing.T -- Parallel would be nice but tricky
+// TODO flesh this out with more useful stuff from testing.T
 type TestingT interface {
 	// Fail marks the function as having failed but continues execution.
 	Fail()
@@ -92,15 +272,66 @@ type TestingT interface {
 	// created during the test. Calling FailNow does not stop
 	// those other goroutines.
 	FailNow()
+	// Failed reports whether the function has failed, including because any of its subtests failed.
+	Failed() bool
+	// Name returns the name of the running test or subtest, relative to its package.
+	// This is the registered test name followed by the name of each subtest, separated by slashes,
+	// and is the same whether the test is run with Run or RunAsTest.
+	// Before/After functions get the name of the test they are run for, or an empty string for the package.
+	Name() string
+	// Deadline reports the time at which the test will be abandoned for exceeding its timeout,
+	// or at which the run will be cancelled, whichever comes first.
+	// If neither applies, ok is false.
+	// When run with RunAsTest, this is the deadline set by the `go test -timeout` flag instead.
+	// Time spent waiting in Parallel does not count against the timeout, so the deadline is only set once the test is running.
+	Deadline() (deadline time.Time, ok bool)
 	// Fatal is equivalent to Log followed by FailNow.
 	Fatal(args ...interface{})
 	// Fatalf is equivalent to Logf followed by FailNow.
 	Fatalf(format string, args ...interface{})
 	// Errorf is equivalent to Logf followed by Fail.
 	Errorf(format string, args ...interface{})
-	// Helper does not do anything useful since the call stack when passed to the actual implementation has an extra
-	// level in it.
+	// Helper marks the calling function as a test helper function.
+	// When finding the file and line that a message was emitted from, that function is skipped.
+	// When run with RunAsTest, go test reports the location of messages itself,
+	// and it only knows about the functions of this package that call Helper, not the callers of this method.
 	Helper()
+	// Skip is equivalent to Log followed by SkipNow.
+	Skip(args ...interface{})
+	// Skipf is equivalent to Logf followed by SkipNow.
+	Skipf(format string, args ...interface{})
+	// SkipNow marks the test as having been skipped and stops its execution
+	// by calling runtime.Goexit.
+	// If a test fails (see Error, Errorf, Fail) and is then skipped,
+	// it is still considered to have failed.
+	// Execution will continue at the next test or benchmark. See also FailNow.
+	// SkipNow must be called from the goroutine running the test, not from
+	// other goroutines created during the test. Calling SkipNow does not stop
+	// those other goroutines.
+	SkipNow()
+	// Skipped reports whether the test was skipped.
+	Skipped() bool
+	// Cleanup registers a function to be called when the test (or subtest) and all its
+	// subtests complete. Cleanup functions will be called in last added,
+	// first called order.
+	// A panic in a cleanup function marks the test as failed and the remaining cleanup functions are still called.
+	// When called from Before/After functions, the cleanup function is called once AfterPackage
+	// (or AfterTest) has returned, and a failure is reported as a failure of AfterPackage (or AfterTest).
+	Cleanup(func())
+	// TempDir returns a temporary directory for the test to use.
+	// The directory is automatically removed when the test and
+	// all its subtests complete.
+	// Each subsequent call to TempDir returns a unique directory;
+	// if the directory creation fails, TempDir terminates the test by calling Fatal.
+	TempDir() string
+	// Setenv calls os.Setenv(key, value) and uses Cleanup to
+	// restore the environment variable to its original value
+	// after the test.
+	//
+	// Because Setenv affects the whole process, it cannot be used
+	// in parallel tests or tests with parallel ancestors.
+	// When using Run, it also affects tests in other packages if RunOptions.PackageConcurrency is more than 1.
+	Setenv(key, value string)
 	// Log formats its arguments using default formatting, analogous to Println,
 	// and records the text in the error log. For tests, the text will be printed only if
 	// the test fails or the -test.v flag is set.
@@ -110,19 +341,37 @@ type TestingT interface {
 	// tests, the text will be printed only if the test fails or the -test.v flag is
 	// set.
 	Logf(format string, args ...interface{})
+	// Logger returns a logger whose records are added to the test's messages, along with their attributes.
+	// Records at any level are kept, and logging at slog.LevelError does not mark the test as failed.
+	// When run with RunAsTest, records are formatted by slog.TextHandler and passed to Log instead,
+	// so go test reports them at a location in log/slog.
+	Logger() *slog.Logger
+	// Output returns a writer whose output is added to the test's messages, one message per line,
+	// which can be passed to clients or loggers of the code under test.
+	// A final line without a newline is added once the test finishes.
+	// When run with RunAsTest, each line is passed to Log instead.
+	Output() io.Writer
 	// Run runs f as a subtest of t called name. It runs f in a separate goroutine
-	// and blocks until f returns (or, if running via go test, calls t.Parallel to become a parallel test).
-	// Run reports whether f succeeded (or, if running via go test, at least did not fail before calling t.Parallel).
+	// and blocks until f returns or calls t.Parallel to become a parallel test.
+	// Run reports whether f succeeded (or at least did not fail before calling t.Parallel).
 	//
 	// Run may be called simultaneously from multiple goroutines, but all such calls
 	// must return before the outer test function for t returns.
 	Run(string, Tester) bool
+	// Context returns a context that is cancelled once the test and all of its subtests have finished.
+	// When run via RunContext, it is also cancelled when the context passed to RunContext is.
+	// Tests should use it for any requests they make so that they stop promptly when the run is cancelled.
+	Context() context.Context
 	// Parallel signals that this test is to be run in parallel with (and only with)
 	// other parallel tests. When a test is run multiple times due to use of
 	// -test.count or -test.cpu, multiple instances of a single test never run in
 	// parallel with each other.
 	//
-	// Parallel only affects RunAsTest as it relies on testing.T's implementation.
+	// A parallel test pauses until its parent's function has returned, and then runs alongside its parallel siblings.
+	// When run via Run, top level tests are treated as subtests of their package for this purpose,
+	// and the number of tests running in parallel is limited by RunOptions.Parallel.
+	// The iterations of a test run RunOptions.Count times only run in parallel with each other
+	// if RunOptions.CountConcurrency allows it.
 	Parallel()
 }
 
@@ -140,23 +389,57 @@ func sanitizeName(r rune) rune {
 	}
 }
 
-// SumTestStats returns the total number of leaf subtests, as well as the number of those that passed and failed.
-func (tr TestResult) SumTestStats() (total, passed, failed int) {
+// TestStats contains the number of leaf subtests of a TestResult with each result.
+type TestStats struct {
+	Total     int
+	Passed    int
+	Failed    int
+	Cancelled int
+	Skipped   int
+	// Flaky is the number of leaf subtests of tests that only passed once they were retried.
+	Flaky int
+}
+
+// Stats returns the number of leaf subtests with each result.
+func (tr TestResult) Stats() TestStats {
 	if len(tr.Subtests) == 0 {
-		if tr.Result == ResultFailed {
-			return 1, 0, 1
-		} else {
-			return 1, 1, 0
+		switch tr.Result {
+		case ResultFailed:
+			return TestStats{Total: 1, Failed: 1}
+		case ResultCancelled:
+			return TestStats{Total: 1, Cancelled: 1}
+		case ResultSkipped:
+			return TestStats{Total: 1, Skipped: 1}
+		case ResultFlaky:
+			return TestStats{Total: 1, Flaky: 1}
+		default:
+			return TestStats{Total: 1, Passed: 1}
 		}
 	}
 
+	var stats TestStats
 	for _, st := range tr.Subtests {
-		t, p, f := st.SumTestStats()
-		total += t
-		passed += p
-		failed += f
+		s := st.Stats()
+		stats.Total += s.Total
+		stats.Passed += s.Passed
+		stats.Failed += s.Failed
+		stats.Cancelled += s.Cancelled
+		stats.Skipped += s.Skipped
+		stats.Flaky += s.Flaky
+	}
+	if tr.Result == ResultFlaky && len(tr.Attempts) > 0 {
+		// the subtests passed this time, but they didn't on an earlier attempt
+		stats.Flaky += stats.Passed
+		stats.Passed = 0
 	}
-	return total, passed, failed
+	return stats
+}
+
+// SumTestStats returns the total number of leaf subtests, as well as the number of those that passed and failed.
+// Use Stats to also get the number of leaf subtests with other results.
+func (tr TestResult) SumTestStats() (total, passed, failed int) {
+	stats := tr.Stats()
+	return stats.Total, stats.Passed, stats.Failed
 }
 
 // TotalSubtests returns the total number of leaf subtests.
@@ -183,6 +466,27 @@ func (tr TestResult) FailedSubtests() int {
 	return failed
 }
 
+// CancelledSubtests returns the number of leaf subtests that were cancelled.
+// Prefer to use Stats, as that returns more information for the same recursion cost;
+// this is intended for Go templates, which are more limited in what you can do.
+func (tr TestResult) CancelledSubtests() int {
+	return tr.Stats().Cancelled
+}
+
+// SkippedSubtests returns the number of leaf subtests that were skipped.
+// Prefer to use Stats, as that returns more information for the same recursion cost;
+// this is intended for Go templates, which are more limited in what you can do.
+func (tr TestResult) SkippedSubtests() int {
+	return tr.Stats().Skipped
+}
+
+// FlakySubtests returns the number of leaf subtests of tests that only passed once they were retried.
+// Prefer to use Stats, as that returns more information for the same recursion cost;
+// this is intended for Go templates, which are more limited in what you can do.
+func (tr TestResult) FlakySubtests() int {
+	return tr.Stats().Flaky
+}
+
 // FindFailingTests finds the least deeply nested subtests that have sibling tests that passed.
 // These subtests may be in different branches of subtests.
 // This implies that this test failed; if it did not, then a nil slice is returned.
@@ -2,6 +2,7 @@ package testy
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -114,6 +115,18 @@ func TestSumTestStats(t *testing.T) {
 	})
 }
 
+func TestResultStats(t *testing.T) {
+	tr := TestResult{
+		Result: ResultFailed,
+		Subtests: []TestResult{
+			{Result: ResultPassed},
+			{Result: ResultFailed},
+			{Result: ResultCancelled, Subtests: []TestResult{{Result: ResultPassed}, {Result: ResultCancelled}}},
+		},
+	}
+	assert.Equal(t, TestStats{Total: 4, Passed: 2, Failed: 1, Cancelled: 1}, tr.Stats())
+}
+
 func TestFindFailingTests(t *testing.T) {
 	t.Run("full tree", func(t *testing.T) {
 		failed := testResultTestData.FindFailingTests()
@@ -147,3 +160,28 @@ func TestFindFailingTests(t *testing.T) {
 		assert.Equal(t, "tree 2 intermediate 1", failed[0].Name)
 	})
 }
+
+func TestNewIterationStats(t *testing.T) {
+	var iterations []TestResult
+	for i := 1; i <= 20; i++ {
+		r := ResultPassed
+		if i%5 == 0 {
+			r = ResultFailed
+		}
+		iterations = append(iterations, TestResult{Result: r, Dur: time.Duration(21-i) * time.Millisecond})
+	}
+	iterations = append(iterations, TestResult{Result: ResultCancelled})
+
+	assert.Equal(t, &IterationStats{
+		Count:    20,
+		Passed:   16,
+		Failed:   4,
+		PassRate: 80,
+		Min:      time.Millisecond,
+		Median:   10 * time.Millisecond,
+		P95:      19 * time.Millisecond,
+		Max:      20 * time.Millisecond,
+	}, newIterationStats(iterations))
+
+	assert.Equal(t, &IterationStats{}, newIterationStats(iterations[20:]))
+}
@@ -0,0 +1,200 @@
+package testy
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watch abandons the test if it runs for longer than its timeout.
+// Time spent waiting in Parallel for other tests to finish does not count against the timeout.
+func (t *t) watch() {
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	// these are set to nil once handled, since a closed channel is always ready.
+	// resumed is only watched once paused has been handled, since both may already be closed by the time we look.
+	paused := t.paused
+	var resumed chan struct{}
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-paused:
+			paused = nil
+			resumed = t.resumed
+			if !timer.Stop() {
+				// drain the channel without blocking, since whether a value is waiting depends on the Go version
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-resumed:
+			resumed = nil
+			timer.Reset(t.timeout)
+		case <-timer.C:
+			t.timeOut()
+			return
+		}
+	}
+}
+
+// timeOut marks the test as failed and finished so that the run can continue without it.
+// The test's goroutine (and those of its subtests) cannot be stopped, so they are left running in the background,
+// but anything they do from now on is ignored.
+func (t *t) timeOut() {
+	stacks := goroutineStacks(t.goroutines())
+
+	t.mu.Lock()
+	if t.finished {
+		// it finished just in time
+		t.mu.Unlock()
+		return
+	}
+	// once this is set, finish will not record the test's result
+	t.timedOut = true
+	t.mu.Unlock()
+
+	msg := Msg{
+		Msg:   fmt.Sprintf("test timed out after %v\n\n%s", t.timeout, stacks),
+		Level: LevelError,
+	}
+	res := t.snapshot()
+	res.Result = ResultFailed
+	res.Msgs = append(res.Msgs, msg)
+
+	t.mu.Lock()
+	t.result = res
+	t.mu.Unlock()
+
+	t.cancel(fmt.Errorf("test timed out after %v", t.timeout))
+	t.releaseSlots()
+	// the test is now abandoned, so we have to report this directly
+	if t.attempt == 0 {
+		t.cfg.emit(Event{Kind: EventTestFinished, Package: t.pkg, Name: t.name, Result: &res})
+	}
+	close(t.done)
+}
+
+// releaseSlots releases the parallel slots held by the test and all of its unfinished subtests,
+// so that other parallel tests are not blocked by abandoned ones.
+func (t *t) releaseSlots() {
+	t.releaseSlot()
+
+	t.mu.Lock()
+	subtests := t.subtests
+	t.mu.Unlock()
+	for _, st := range subtests {
+		select {
+		case <-st.done:
+		default:
+			st.releaseSlots()
+		}
+	}
+}
+
+// snapshot returns the result of a test that has not finished yet, including everything its subtests have done so far.
+// Any subtests which had not finished are marked as failed.
+func (t *t) snapshot() TestResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := ResultPassed
+	if t.failed {
+		r = ResultFailed
+	} else if t.skipped {
+		r = ResultSkipped
+	}
+	var subtests []TestResult
+	for _, st := range t.subtests {
+		var res TestResult
+		select {
+		case <-st.done:
+			res = st.result
+		default:
+			res = st.snapshot()
+			res.Result = ResultFailed
+			res.Msgs = append(res.Msgs, Msg{
+				Msg:   "did not finish before the test timed out",
+				Level: LevelError,
+			})
+		}
+		r = worstResult(r, res.Result)
+		subtests = append(subtests, res)
+	}
+
+	dur := time.Since(t.start).Round(time.Millisecond)
+	return TestResult{
+		Package:  t.pkg,
+		Name:     t.name,
+		Msgs:     append([]Msg(nil), t.msgs...),
+		Result:   r,
+		Started:  t.start,
+		Dur:      dur,
+		DurHuman: dur.String(),
+		Subtests: subtests,
+		Metadata: t.metadata,
+		Hooks:    append([]TestResult(nil), t.hooks...),
+	}
+}
+
+// goroutines returns the IDs of the goroutines running the test and all of its unfinished subtests.
+func (t *t) goroutines() map[int64]bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := map[int64]bool{}
+	if t.goroutine != 0 {
+		ids[t.goroutine] = true
+	}
+	for _, st := range t.subtests {
+		select {
+		case <-st.done:
+		default:
+			for id := range st.goroutines() {
+				ids[id] = true
+			}
+		}
+	}
+	return ids
+}
+
+// goroutineID returns the ID of the calling goroutine.
+// The runtime deliberately does not expose this, but it is the only way to find a specific goroutine's stack.
+func goroutineID() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// the stack starts with "goroutine 123 [running]:"
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i >= 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseInt(string(buf), 10, 64)
+	return id
+}
+
+// goroutineStacks returns the stack traces of the goroutines with the provided IDs.
+func goroutineStacks(ids map[int64]bool) string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var stacks []string
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		var id int64
+		if _, err := fmt.Sscanf(stack, "goroutine %d ", &id); err == nil && ids[id] {
+			stacks = append(stacks, stack)
+		}
+	}
+	return strings.Join(stacks, "\n\n")
+}
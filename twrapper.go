@@ -1,64 +1,181 @@
 package testy
 
 import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
 	"testing"
+	"time"
 )
 
 // tWrapper wraps a real testing.T, because Run takes a concrete implementation.
 type tWrapper struct {
 	t *testing.T
+	// prefix is removed from the name of t. It is the name of the test that called RunAsTest, followed by a slash.
+	prefix string
+	// pkgTests is the package being run, for its BeforeEach and AfterEach. It may be nil.
+	pkgTests *testPkg
 }
 
 var _ TestingT = (*tWrapper)(nil)
 
 func (t tWrapper) Fail() {
-	t.Helper()
+	t.t.Helper()
 	t.t.Fail()
 }
 
 func (t tWrapper) FailNow() {
-	t.Helper()
+	t.t.Helper()
 	t.t.FailNow()
 }
 
+func (t tWrapper) Failed() bool {
+	return t.t.Failed()
+}
+
+func (t tWrapper) Name() string {
+	name := t.t.Name()
+	if name+"/" == t.prefix {
+		// Before/After package functions are run directly by RunAsTest's test
+		return ""
+	}
+	return strings.TrimPrefix(name, t.prefix)
+}
+
+func (t tWrapper) Deadline() (deadline time.Time, ok bool) {
+	return t.t.Deadline()
+}
+
 func (t tWrapper) Fatal(args ...interface{}) {
-	t.Helper()
+	t.t.Helper()
 	t.t.Fatal(args...)
 }
 
 func (t tWrapper) Fatalf(format string, args ...interface{}) {
-	t.Helper()
+	t.t.Helper()
 	t.t.Fatalf(format, args...)
 }
 
 func (t tWrapper) Errorf(format string, args ...interface{}) {
-	t.Helper()
+	t.t.Helper()
 	t.t.Errorf(format, args...)
 }
 
+func (t tWrapper) Skip(args ...interface{}) {
+	t.t.Helper()
+	t.t.Skip(args...)
+}
+
+func (t tWrapper) Skipf(format string, args ...interface{}) {
+	t.t.Helper()
+	t.t.Skipf(format, args...)
+}
+
+func (t tWrapper) SkipNow() {
+	t.t.Helper()
+	t.t.SkipNow()
+}
+
+func (t tWrapper) Skipped() bool {
+	return t.t.Skipped()
+}
+
+func (t tWrapper) Cleanup(f func()) {
+	t.t.Helper()
+	t.t.Cleanup(f)
+}
+
+func (t tWrapper) TempDir() string {
+	t.t.Helper()
+	return t.t.TempDir()
+}
+
+func (t tWrapper) Setenv(key, value string) {
+	t.t.Helper()
+	t.t.Setenv(key, value)
+}
+
+// Helper can only mark itself as a helper function of the real testing.T, not its caller,
+// so go test reports messages from the caller's helpers at the line in the helper.
 func (t tWrapper) Helper() {
-	// this probably doesn't actually work right since the call stack is incorrect
 	t.t.Helper()
 }
 
 func (t tWrapper) Log(args ...interface{}) {
-	t.Helper()
+	t.t.Helper()
 	t.t.Log(args...)
 }
 
 func (t tWrapper) Logf(format string, args ...interface{}) {
-	t.Helper()
+	t.t.Helper()
 	t.t.Logf(format, args...)
 }
 
+func (t tWrapper) Logger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(&lineWriter{log: t.logLine}, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// go test already reports when each message was logged relative to its test
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+func (t tWrapper) Output() io.Writer {
+	w := &lineWriter{log: t.logLine}
+	t.t.Cleanup(w.flush)
+	return w
+}
+
+// logLine passes a line written to Output or Logger to Log, which adds its own newline.
+func (t tWrapper) logLine(line string) {
+	t.t.Helper()
+	t.t.Log(strings.TrimSuffix(line, "\n"))
+}
+
 func (t tWrapper) Run(s string, tester Tester) bool {
 	t.t.Helper()
 	return t.t.Run(s, func(tt *testing.T) {
 		t.t.Helper()
-		tester(tWrapper{t: tt})
+		tw := tWrapper{t: tt, prefix: t.prefix, pkgTests: t.pkgTests}
+		if t.pkgTests == nil {
+			tester(tw)
+			return
+		}
+
+		// if we have an AfterEach, defer it so it always runs even if BeforeEach or the subtest itself fail or panic
+		if t.pkgTests.AfterEach != nil {
+			defer t.pkgTests.AfterEach(tw)
+		}
+
+		// if we have a BeforeEach, just run it directly; FailNow, SkipNow and panics will sort themselves out
+		if t.pkgTests.BeforeEach != nil {
+			t.pkgTests.BeforeEach(tw)
+			if tt.Failed() {
+				return
+			}
+		}
+
+		tester(tw)
 	})
 }
 
 func (t tWrapper) Parallel() {
 	t.t.Parallel()
 }
+
+// Context returns a context that is cancelled when the test finishes.
+// testing.T only provides its own Context as of Go 1.24, so with older toolchains this returns a new context each time
+// it is called, which is cancelled by a Cleanup function registered at the same time.
+func (t tWrapper) Context() context.Context {
+	if c, ok := any(t.t).(interface{ Context() context.Context }); ok {
+		return c.Context()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.t.Cleanup(cancel)
+	return ctx
+}
@@ -0,0 +1,122 @@
+package testy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTWrapperName(t *testing.T) {
+	tw := tWrapper{t: t, prefix: t.Name() + "/"}
+	assert.Equal(t, "", tw.Name())
+
+	tw.Run("test", func(tt TestingT) {
+		assert.Equal(t, "test", tt.Name())
+		tt.Run("sub test", func(tt TestingT) {
+			assert.Equal(t, "test/sub_test", tt.Name())
+		})
+	})
+}
+
+func TestTWrapperEachHooks(t *testing.T) {
+	var ran []string
+	pkgTests := &testPkg{
+		BeforeEach: func(t TestingT) {
+			ran = append(ran, "before "+t.Name())
+		},
+		AfterEach: func(t TestingT) {
+			ran = append(ran, "after "+t.Name())
+		},
+	}
+	tw := tWrapper{t: t, prefix: t.Name() + "/", pkgTests: pkgTests}
+
+	tw.Run("a", func(tt TestingT) {
+		tt.Run("b", func(tt TestingT) {
+			ran = append(ran, tt.Name())
+		})
+	})
+	assert.Equal(t, []string{"before a", "before a/b", "a/b", "after a/b", "after a"}, ran)
+}
+
+// helperProcess reports whether the test is being run by loggedLines, in which case it should only log.
+func helperProcess() bool {
+	return os.Getenv("TESTY_HELPER_PROCESS") == "1"
+}
+
+// loggedLines runs the named test in a new test process with any extra flags, and returns the lines that it passed to
+// testing.T.Log (or Errorf, etc.) and whether it failed.
+// This is the only way to see what a real testing.T logged.
+func loggedLines(t *testing.T, name string, flags ...string) ([]string, bool) {
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^" + name + "$", "-test.v"}, flags...)...)
+	cmd.Env = append(os.Environ(), "TESTY_HELPER_PROCESS=1")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		require.NoError(t, err, string(out))
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		// logged lines are indented and start with their location, such as "    handler.go:321: "
+		if !strings.HasPrefix(line, "    ") {
+			continue
+		}
+		if _, msg, ok := strings.Cut(strings.TrimSpace(line), ".go:"); ok {
+			_, msg, _ = strings.Cut(msg, ": ")
+			lines = append(lines, msg)
+		}
+	}
+	return lines, err != nil
+}
+
+func TestTWrapperLogger(t *testing.T) {
+	if helperProcess() {
+		tw := tWrapper{t: t, prefix: t.Name() + "/"}
+		logger := tw.Logger().With("service", "api").WithGroup("request")
+		logger.Debug("logged via t.Log", "method", "GET", slog.Group("headers", "accept", "json"))
+		logger.Warn("deprecated")
+		return
+	}
+
+	lines, failed := loggedLines(t, t.Name())
+	assert.False(t, failed)
+	assert.Equal(t, []string{
+		`level=DEBUG msg="logged via t.Log" service=api request.method=GET request.headers.accept=json`,
+		`level=WARN msg=deprecated service=api`,
+	}, lines)
+}
+
+func TestTWrapperOutput(t *testing.T) {
+	if helperProcess() {
+		tw := tWrapper{t: t, prefix: t.Name() + "/"}
+		w := tw.Output()
+		fmt.Fprint(w, "first\nsecond ")
+		fmt.Fprint(w, "line\nand flushed by Cleanup")
+		return
+	}
+
+	lines, failed := loggedLines(t, t.Name())
+	assert.False(t, failed)
+	assert.Equal(t, []string{"first", "second line", "and flushed by Cleanup"}, lines)
+}
+
+func TestTWrapperContext(t *testing.T) {
+	var ctx context.Context
+	t.Run("test", func(tt *testing.T) {
+		tw := tWrapper{t: tt, prefix: t.Name() + "/"}
+		ctx = tw.Context()
+		if _, ok := any(tt).(interface{ Context() context.Context }); ok {
+			assert.Equal(t, ctx, tw.Context(), "every call returns the test's own context")
+		}
+		assert.NoError(t, ctx.Err())
+	})
+	assert.Error(t, ctx.Err(), "the context is cancelled once the test finishes")
+}